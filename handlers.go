@@ -1,14 +1,20 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
 	"net/http"
+	"path"
 	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
 	. "github.com/lirios/ci/service"
-	"github.com/nu7hatch/gouuid"
 )
 
 var nothing = map[string]string{}
@@ -35,7 +41,7 @@ func wsHandler(c context, w http.ResponseWriter, r *http.Request) (int, interfac
 	c.Hub().Register(conn)
 	defer c.Hub().Unregister(conn)
 	go conn.Writer()
-	conn.Reader()
+	conn.Reader(c.Hub())
 	return http.StatusOK, nothing
 }
 
@@ -65,6 +71,59 @@ func getJob(c context, w http.ResponseWriter, r *http.Request) (int, interface{}
 	return http.StatusOK, job
 }
 
+func updateJob(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	vars := mux.Vars(r)
+	job, err := c.JobList().Get(vars["job"])
+	if err != nil {
+		return http.StatusNotFound, err.Error()
+	}
+
+	var payload struct {
+		Timeout    *int               `json:"timeout"`
+		Parameters *[]Parameter       `json:"parameters"`
+		Env        *map[string]string `json:"env"`
+		Secrets    *[]string          `json:"secrets"`
+		Workspace  *string            `json:"workspace"`
+		Requeue    *bool              `json:"requeue_interrupted"`
+	}
+	err = decode(r.Body, &payload)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+
+	j := job.(Job)
+	if payload.Timeout != nil {
+		if *payload.Timeout < 0 {
+			return http.StatusBadRequest, "Timeout cannot be negative"
+		}
+		j.Timeout = *payload.Timeout
+	}
+	if payload.Parameters != nil {
+		j.Parameters = *payload.Parameters
+	}
+	if payload.Env != nil {
+		j.Env = *payload.Env
+	}
+	if payload.Secrets != nil {
+		j.Secrets = *payload.Secrets
+	}
+	if payload.Workspace != nil {
+		j.Workspace = *payload.Workspace
+	}
+	if payload.Requeue != nil {
+		j.RequeueInterrupted = *payload.Requeue
+	}
+	err = j.Validate(c.TaskList())
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	err = c.JobList().Update(j)
+	if err != nil {
+		return http.StatusInternalServerError, err.Error()
+	}
+	return http.StatusOK, nothing
+}
+
 func deleteJob(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
 	vars := mux.Vars(r)
 	job, err := c.JobList().Get(vars["job"])
@@ -76,10 +135,30 @@ func deleteJob(c context, w http.ResponseWriter, r *http.Request) (int, interfac
 	if err != nil {
 		return http.StatusInternalServerError, err.Error()
 	}
+	c.Executor().Reconcile()
 
 	return http.StatusOK, nothing
 }
 
+// Settings of a task within a job, only the provided ones are changed.
+type jobTaskPayload struct {
+	Needs        *[]string `json:"needs"`
+	AllowFailure *bool     `json:"allow_failure"`
+	AlwaysRun    *bool     `json:"always_run"`
+}
+
+func (p jobTaskPayload) apply(task *JobTask) {
+	if p.Needs != nil {
+		task.Needs = *p.Needs
+	}
+	if p.AllowFailure != nil {
+		task.AllowFailure = *p.AllowFailure
+	}
+	if p.AlwaysRun != nil {
+		task.AlwaysRun = *p.AlwaysRun
+	}
+}
+
 func addTaskToJob(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
 	vars := mux.Vars(r)
 	job, err := c.JobList().Get(vars["job"])
@@ -88,13 +167,61 @@ func addTaskToJob(c context, w http.ResponseWriter, r *http.Request) (int, inter
 	}
 	j := job.(Job)
 
-	payload := unmarshal(r.Body, "task", w)
-	j.AppendTask(payload["task"])
+	var payload struct {
+		Task string `json:"task"`
+		jobTaskPayload
+	}
+	err = decode(r.Body, &payload)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if payload.Task == "" {
+		return http.StatusBadRequest, "Please provide a 'task'"
+	}
+	task := JobTask{Name: payload.Task}
+	payload.apply(&task)
+	j.AppendTask(task.Name)
+	j.SetTask(len(j.Tasks)-1, task)
+	err = j.Validate(c.TaskList())
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
 	c.JobList().Update(j)
 
 	return http.StatusCreated, nothing
 }
 
+func updateTaskOfJob(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	vars := mux.Vars(r)
+	job, err := c.JobList().Get(vars["job"])
+	if err != nil {
+		return http.StatusNotFound, err.Error()
+	}
+	j := job.(Job)
+
+	taskPosition, err := strconv.Atoi(vars["task"])
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	task, err := j.GetTask(taskPosition)
+	if err != nil {
+		return http.StatusNotFound, err.Error()
+	}
+	var payload jobTaskPayload
+	err = decode(r.Body, &payload)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	payload.apply(&task)
+	j.SetTask(taskPosition, task)
+	err = j.Validate(c.TaskList())
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	c.JobList().Update(j)
+	return http.StatusOK, nothing
+}
+
 func removeTaskFromJob(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
 	vars := mux.Vars(r)
 	job, err := c.JobList().Get(vars["job"])
@@ -107,7 +234,14 @@ func removeTaskFromJob(c context, w http.ResponseWriter, r *http.Request) (int,
 	if err != nil {
 		return http.StatusBadRequest, err.Error()
 	}
-	j.DeleteTask(taskPosition)
+	err = j.DeleteTask(taskPosition)
+	if err != nil {
+		return http.StatusNotFound, err.Error()
+	}
+	err = j.Validate(c.TaskList())
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
 	c.JobList().Update(j)
 	return http.StatusOK, nothing
 }
@@ -122,13 +256,13 @@ func addTriggerToJob(c context, w http.ResponseWriter, r *http.Request) (int, in
 
 	payload := unmarshal(r.Body, "trigger", w)
 
-	j.AppendTrigger(payload["trigger"])
-	t, err := c.TriggerList().Get(payload["trigger"])
+	_, err = c.TriggerList().Get(payload["trigger"])
 	if err != nil {
-		return http.StatusInternalServerError, err.Error()
+		return http.StatusNotFound, err.Error()
 	}
-	c.Executor().ArmTrigger(t.(Trigger))
+	j.AppendTrigger(payload["trigger"])
 	c.JobList().Update(j)
+	c.Executor().Reconcile()
 
 	return http.StatusCreated, nothing
 }
@@ -145,12 +279,8 @@ func removeTriggerFromJob(c context, w http.ResponseWriter, r *http.Request) (in
 	j.DeleteTrigger(t)
 	c.JobList().Update(j)
 
-	// If Trigger is no longer attached to any Jobs, remove it from Cron to save cycles
-	jobs := c.JobList().GetJobsWithTrigger(t)
-
-	if len(jobs) == 0 {
-		c.Executor().DisarmTrigger(t)
-	}
+	// Triggers no longer attached to any job are removed from cron
+	c.Executor().Reconcile()
 	return http.StatusOK, nothing
 }
 
@@ -181,34 +311,39 @@ func listRuns(c context, w http.ResponseWriter, r *http.Request) (int, interface
 }
 
 func addRun(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
-	payload := unmarshal(r.Body, "job", w)
+	var payload struct {
+		Job        string                 `json:"job"`
+		Parameters map[string]interface{} `json:"parameters"`
+	}
+	err := decode(r.Body, &payload)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if payload.Job == "" {
+		return http.StatusBadRequest, "Please provide a 'job'"
+	}
 
-	job, err := c.JobList().Get(payload["job"])
+	job, err := c.JobList().Get(payload.Job)
 	if err != nil {
 		return http.StatusInternalServerError, err.Error()
 	}
 	j := job.(Job)
 
-	id, err := uuid.NewV4()
+	parameters, err := stringValues(payload.Parameters)
 	if err != nil {
-		return http.StatusInternalServerError, err.Error()
+		return http.StatusBadRequest, err.Error()
 	}
-
-	var tasks []Task
-	for _, taskName := range j.Tasks {
-		task, err2 := c.TaskList().Get(taskName)
-		if err2 != nil {
-			panic(err2)
-		}
-		t := task.(Task)
-		tasks = append(tasks, t)
+	_, err = j.ResolveParameters(parameters)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
 	}
-	err = c.RunList().AddRun(id.String(), filepath.Join(c.Settings().Server.OutputPath, "files", "logs"), j, tasks)
+
+	id, err := c.Executor().RunJob(j, parameters)
 	if err != nil {
 		return http.StatusInternalServerError, err.Error()
 	}
 
-	return http.StatusCreated, map[string]string{"uuid": id.String()}
+	return http.StatusCreated, map[string]string{"uuid": id}
 }
 
 func getRun(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
@@ -217,7 +352,227 @@ func getRun(c context, w http.ResponseWriter, r *http.Request) (int, interface{}
 	if err != nil {
 		return http.StatusNotFound, err.Error()
 	}
-	return http.StatusOK, run
+	rr := run.(Run)
+	rr.Position = c.Executor().QueuePosition(rr.UUID)
+	return http.StatusOK, rr
+}
+
+func listArtifacts(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	vars := mux.Vars(r)
+	run, err := c.RunList().Get(vars["run"])
+	if err != nil {
+		return http.StatusNotFound, err.Error()
+	}
+	artifacts := run.(Run).Artifacts
+	if artifacts == nil {
+		artifacts = []Artifact{}
+	}
+	return http.StatusOK, artifacts
+}
+
+func downloadArtifact(c context, w http.ResponseWriter, r *http.Request) (int, error) {
+	vars := mux.Vars(r)
+	run, err := c.RunList().Get(vars["run"])
+	if err != nil {
+		return http.StatusNotFound, err
+	}
+	artifact, ok := run.(Run).Artifact(vars["artifact"])
+	if !ok {
+		return http.StatusNotFound, errors.New("No artifact with that path found")
+	}
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+path.Base(artifact.Path)+"\"")
+	http.ServeFile(w, r, filepath.Join(ArtifactsPath(c.Settings(), run.ID()), filepath.FromSlash(artifact.Path)))
+	return http.StatusOK, nil
+}
+
+func downloadArtifactsZip(c context, w http.ResponseWriter, r *http.Request) (int, error) {
+	vars := mux.Vars(r)
+	run, err := c.RunList().Get(vars["run"])
+	if err != nil {
+		return http.StatusNotFound, err
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", "attachment; filename=\""+run.ID()+".zip\"")
+	out := &countingWriter{Writer: w}
+	err = WriteArtifactsZip(c.Settings(), run.(Run), out)
+	if err != nil && out.count > 0 {
+		// The status went with the first bytes, the client can only get a
+		// truncated archive
+		log.Printf("Error sending the artifacts of run %s: %v\n", run.ID(), err)
+		return http.StatusOK, nil
+	}
+	if err != nil {
+		w.Header().Del("Content-Disposition")
+		return http.StatusInternalServerError, err
+	}
+	return http.StatusOK, nil
+}
+
+// Counts the bytes written to a response.
+type countingWriter struct {
+	io.Writer
+	count int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.count += int64(n)
+	return n, err
+}
+
+func getLog(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	vars := mux.Vars(r)
+	run, err := c.RunList().Get(vars["run"])
+	if err != nil {
+		return http.StatusNotFound, err.Error()
+	}
+	result, ok := run.(Run).Result(vars["log"])
+	if !ok {
+		return http.StatusNotFound, "No log with that name found"
+	}
+	entries, err := result.ReadLog(r.URL.Query().Get("stream"))
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	return http.StatusOK, entries
+}
+
+func getLogText(c context, w http.ResponseWriter, r *http.Request) (int, error) {
+	vars := mux.Vars(r)
+	run, err := c.RunList().Get(vars["run"])
+	if err != nil {
+		return http.StatusNotFound, err
+	}
+	result, ok := run.(Run).Result(vars["log"])
+	if !ok {
+		return http.StatusNotFound, errors.New("No log with that name found")
+	}
+	entries, err := result.ReadLog(r.URL.Query().Get("stream"))
+	if err != nil {
+		return http.StatusBadRequest, err
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	for _, entry := range entries {
+		io.WriteString(w, entry.Line+"\n")
+	}
+	return http.StatusOK, nil
+}
+
+// Returns the body of the webhook request that started a run.
+func getPayload(c context, w http.ResponseWriter, r *http.Request) (int, error) {
+	vars := mux.Vars(r)
+	run, err := c.RunList().Get(vars["run"])
+	if err != nil {
+		return http.StatusNotFound, err
+	}
+	if event := run.(Run).Event; event == nil || event.PayloadSize == 0 {
+		return http.StatusNotFound, errors.New("Run has no payload")
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	http.ServeFile(w, r, PayloadPath(c.Settings(), run.ID()))
+	return http.StatusOK, nil
+}
+
+func searchLogs(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	var since time.Time
+	if value := r.FormValue("since"); value != "" {
+		var err error
+		since, err = parseTime(value)
+		if err != nil {
+			return http.StatusBadRequest, "Invalid 'since', expected a date or an RFC 3339 time"
+		}
+	}
+	hits, err := c.RunList().SearchLogs(r.FormValue("q"), r.FormValue("job"), since)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	return http.StatusOK, hits
+}
+
+func rerunRun(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	vars := mux.Vars(r)
+	_, err := c.RunList().Get(vars["run"])
+	if err != nil {
+		return http.StatusNotFound, err.Error()
+	}
+	var payload struct {
+		FromFailed bool `json:"from_failed"`
+	}
+	if r.ContentLength != 0 {
+		err = decode(r.Body, &payload)
+		if err != nil {
+			return http.StatusBadRequest, err.Error()
+		}
+	}
+	id, err := c.Executor().Rerun(vars["run"], payload.FromFailed)
+	if err != nil {
+		return http.StatusConflict, err.Error()
+	}
+	return http.StatusCreated, map[string]string{"uuid": id}
+}
+
+func cancelRun(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	vars := mux.Vars(r)
+	_, err := c.RunList().Get(vars["run"])
+	if err != nil {
+		return http.StatusNotFound, err.Error()
+	}
+	err = c.Executor().Cancel(vars["run"])
+	if err != nil {
+		return http.StatusConflict, err.Error()
+	}
+	return http.StatusOK, nothing
+}
+
+// Pipeline
+
+func exportPipeline(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	return http.StatusOK, ExportPipeline(c.JobList(), c.TaskList(), c.TriggerList())
+}
+
+// Applies a pipeline, or only reports what it would change when dry_run
+// is set.
+func importPipeline(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	var pipeline Pipeline
+	err := decode(r.Body, &pipeline)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if dryRun, _ := strconv.ParseBool(r.FormValue("dry_run")); dryRun {
+		err = pipeline.Validate(c.SecretList())
+		if err != nil {
+			return http.StatusBadRequest, err.Error()
+		}
+		return http.StatusOK, pipeline.Changes(c.JobList(), c.TaskList(), c.TriggerList())
+	}
+	changes, err := pipeline.Apply(c.JobList(), c.TaskList(), c.TriggerList(), c.SecretList(), c.RevisionList(), c.Executor(), author(r))
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	return http.StatusOK, changes
+}
+
+// Queue
+
+func getHousekeeping(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	return http.StatusOK, c.Executor().Housekeeping()
+}
+
+func listQueue(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	return http.StatusOK, c.Executor().Queue()
+}
+
+func removeFromQueue(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	vars := mux.Vars(r)
+	_, err := c.RunList().Get(vars["run"])
+	if err != nil {
+		return http.StatusNotFound, err.Error()
+	}
+	err = c.Executor().Dequeue(vars["run"])
+	if err != nil {
+		return http.StatusConflict, err.Error()
+	}
+	return http.StatusOK, nothing
 }
 
 // Tasks
@@ -233,6 +588,11 @@ func addTask(c context, w http.ResponseWriter, r *http.Request) (int, interface{
 	if err != nil {
 		return http.StatusBadRequest, err.Error()
 	}
+	t, err := c.RevisionList().Record(nil, Task{Name: payload["name"], Script: ""}, author(r))
+	if err != nil {
+		return http.StatusInternalServerError, err.Error()
+	}
+	c.TaskList().Update(t)
 	return http.StatusCreated, nothing
 }
 
@@ -251,9 +611,60 @@ func updateTask(c context, w http.ResponseWriter, r *http.Request) (int, interfa
 	if err != nil {
 		return http.StatusNotFound, err.Error()
 	}
-	payload := unmarshal(r.Body, "script", w)
+
+	var payload struct {
+		Script    *string            `json:"script"`
+		Timeout   *int               `json:"timeout"`
+		Retry     *Retry             `json:"retry"`
+		Env       *map[string]string `json:"env"`
+		Artifacts *[]string          `json:"artifacts"`
+	}
+	err = decode(r.Body, &payload)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if payload.Script == nil && payload.Timeout == nil && payload.Retry == nil && payload.Env == nil && payload.Artifacts == nil {
+		return http.StatusBadRequest, "Please provide a 'script', a 'timeout', a 'retry', an 'env' or 'artifacts'"
+	}
+
 	t := task.(Task)
-	t.Script = payload["script"]
+	if payload.Script != nil {
+		t.Script = *payload.Script
+	}
+	if payload.Timeout != nil {
+		if *payload.Timeout < 0 {
+			return http.StatusBadRequest, "Timeout cannot be negative"
+		}
+		t.Timeout = *payload.Timeout
+	}
+	if payload.Retry != nil {
+		if payload.Retry.MaxAttempts < 0 || payload.Retry.Backoff < 0 {
+			return http.StatusBadRequest, "Retry settings cannot be negative"
+		}
+		t.Retry = payload.Retry
+		if t.Retry.MaxAttempts == 0 {
+			t.Retry = nil
+		}
+	}
+	if payload.Env != nil {
+		err = ValidateEnv(*payload.Env)
+		if err != nil {
+			return http.StatusBadRequest, err.Error()
+		}
+		t.Env = *payload.Env
+	}
+	if payload.Artifacts != nil {
+		err = ValidateArtifacts(*payload.Artifacts)
+		if err != nil {
+			return http.StatusBadRequest, err.Error()
+		}
+		t.Artifacts = *payload.Artifacts
+	}
+	previous := task.(Task)
+	t, err = c.RevisionList().Record(&previous, t, author(r))
+	if err != nil {
+		return http.StatusInternalServerError, err.Error()
+	}
 	c.TaskList().Update(t)
 	return http.StatusOK, nothing
 }
@@ -265,15 +676,120 @@ func deleteTask(c context, w http.ResponseWriter, r *http.Request) (int, interfa
 		return http.StatusNotFound, err.Error()
 	}
 	c.TaskList().Delete(task.ID())
+	c.RevisionList().Delete(task.ID())
 	return http.StatusOK, nothing
 }
 
+func listTaskRevisions(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	vars := mux.Vars(r)
+	_, err := c.TaskList().Get(vars["task"])
+	if err != nil {
+		return http.StatusNotFound, err.Error()
+	}
+	return http.StatusOK, c.RevisionList().Revisions(vars["task"])
+}
+
+func getTaskRevision(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	vars := mux.Vars(r)
+	number, err := strconv.Atoi(vars["revision"])
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	revision, err := c.RevisionList().Revision(vars["task"], number)
+	if err != nil {
+		return http.StatusNotFound, err.Error()
+	}
+	return http.StatusOK, revision
+}
+
+func restoreTaskRevision(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	vars := mux.Vars(r)
+	task, err := c.TaskList().Get(vars["task"])
+	if err != nil {
+		return http.StatusNotFound, err.Error()
+	}
+	number, err := strconv.Atoi(vars["revision"])
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	revision, err := c.RevisionList().Revision(vars["task"], number)
+	if err != nil {
+		return http.StatusNotFound, err.Error()
+	}
+	previous := task.(Task)
+	t, err := c.RevisionList().Record(&previous, revision.Task, author(r))
+	if err != nil {
+		return http.StatusInternalServerError, err.Error()
+	}
+	c.TaskList().Update(t)
+	return http.StatusOK, t
+}
+
+// Diffs the scripts of two revisions, "to" is the current one by default.
+func diffTaskRevisions(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	vars := mux.Vars(r)
+	task, err := c.TaskList().Get(vars["task"])
+	if err != nil {
+		return http.StatusNotFound, err.Error()
+	}
+	from, err := strconv.Atoi(r.FormValue("from"))
+	if err != nil {
+		return http.StatusBadRequest, "Please provide the 'from' revision"
+	}
+	to := task.(Task).Revision
+	if value := r.FormValue("to"); value != "" {
+		to, err = strconv.Atoi(value)
+		if err != nil {
+			return http.StatusBadRequest, err.Error()
+		}
+	}
+	diff, err := c.RevisionList().Diff(vars["task"], from, to)
+	if err != nil {
+		return http.StatusNotFound, err.Error()
+	}
+	return http.StatusOK, map[string]interface{}{"from": from, "to": to, "diff": diff}
+}
+
 func listJobsForTask(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
 	vars := mux.Vars(r)
 	jobs := c.JobList().GetJobsWithTask(vars["task"])
 	return http.StatusOK, jobs
 }
 
+// Secrets
+
+func listSecrets(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	return http.StatusOK, c.SecretList().Info()
+}
+
+func setSecret(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	vars := mux.Vars(r)
+	var payload struct {
+		Value *string `json:"value"`
+	}
+	err := decode(r.Body, &payload)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if payload.Value == nil {
+		return http.StatusBadRequest, "Please provide a 'value'"
+	}
+	err = c.SecretList().Set(vars["secret"], *payload.Value)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	return http.StatusOK, nothing
+}
+
+func deleteSecret(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	vars := mux.Vars(r)
+	err := c.SecretList().Delete(vars["secret"])
+	if err != nil {
+		return http.StatusNotFound, err.Error()
+	}
+	return http.StatusOK, nothing
+}
+
 // Triggers
 
 func listTriggers(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
@@ -282,7 +798,11 @@ func listTriggers(c context, w http.ResponseWriter, r *http.Request) (int, inter
 
 func addTrigger(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
 	payload := unmarshal(r.Body, "name", w)
-	trigger := Trigger{Name: payload["name"]}
+	err := ValidateTriggerType(payload["type"])
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	trigger := Trigger{Name: payload["name"], Type: payload["type"]}
 	c.TriggerList().Append(trigger)
 	return http.StatusCreated, nothing
 }
@@ -303,15 +823,89 @@ func updateTrigger(c context, w http.ResponseWriter, r *http.Request) (int, inte
 		return http.StatusNotFound, err.Error()
 	}
 
-	payload := unmarshal(r.Body, "cron", w)
+	var payload struct {
+		Cron       *string            `json:"cron"`
+		Parameters *map[string]string `json:"parameters"`
+		Type       *string            `json:"type"`
+		Secret     *string            `json:"secret"`
+		Events     *[]string          `json:"events"`
+		Branches   *[]string          `json:"branches"`
+		Tags       *[]string          `json:"tags"`
+		Paths      *[]string          `json:"paths"`
+		Repository *string            `json:"repository"`
+		Interval   *int               `json:"interval"`
+	}
+	err = decode(r.Body, &payload)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if payload.Cron == nil && payload.Parameters == nil && payload.Type == nil && payload.Secret == nil &&
+		payload.Events == nil && payload.Branches == nil && payload.Tags == nil && payload.Paths == nil &&
+		payload.Repository == nil && payload.Interval == nil {
+		return http.StatusBadRequest, "Please provide a 'cron', 'parameters', 'type', 'secret', 'repository', 'interval' or filters"
+	}
 
 	t := trigger.(Trigger)
-	t.Schedule = payload["cron"]
-	c.Executor().ArmTrigger(t)
+	if payload.Type != nil {
+		err = ValidateTriggerType(*payload.Type)
+		if err != nil {
+			return http.StatusBadRequest, err.Error()
+		}
+		t.Type = *payload.Type
+	}
+	if payload.Secret != nil {
+		if *payload.Secret != "" {
+			_, err = c.SecretList().Get(*payload.Secret)
+			if err != nil {
+				return http.StatusBadRequest, err.Error()
+			}
+		}
+		t.Secret = *payload.Secret
+	}
+	if payload.Cron != nil {
+		_, err = ParseSchedule(*payload.Cron)
+		if err != nil {
+			return http.StatusBadRequest, err.Error()
+		}
+		t.Schedule = *payload.Cron
+	}
+	if payload.Parameters != nil {
+		t.Parameters = *payload.Parameters
+	}
+	for _, filter := range []struct{ value, field *[]string }{
+		{payload.Events, &t.Events},
+		{payload.Branches, &t.Branches},
+		{payload.Tags, &t.Tags},
+		{payload.Paths, &t.Paths},
+	} {
+		if filter.value != nil {
+			*filter.field = *filter.value
+		}
+	}
+	if payload.Repository != nil {
+		t.Repository = *payload.Repository
+	}
+	if payload.Interval != nil {
+		if *payload.Interval < 0 {
+			return http.StatusBadRequest, "Interval cannot be negative"
+		}
+		t.Interval = *payload.Interval
+	}
+	err = ValidateEventFilters(t)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if t.Type == PollTrigger {
+		err = ValidateRepository(t.Repository)
+		if err != nil {
+			return http.StatusBadRequest, err.Error()
+		}
+	}
 	err = c.TriggerList().Update(t)
 	if err != nil {
 		return http.StatusInternalServerError, err.Error()
 	}
+	c.Executor().Reconcile()
 
 	return http.StatusOK, nothing
 }
@@ -319,9 +913,124 @@ func updateTrigger(c context, w http.ResponseWriter, r *http.Request) (int, inte
 func deleteTrigger(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
 	vars := mux.Vars(r)
 	c.TriggerList().Delete(vars["trigger"])
+	c.Executor().Reconcile()
+	c.Executor().DeletePollState(vars["trigger"])
 	return http.StatusOK, nothing
 }
 
+// Returns the cron entries of the triggers.
+func listArmedTriggers(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	return http.StatusOK, c.Executor().ArmedTriggers()
+}
+
+// Returns the next times an armed trigger fires.
+func listNextFires(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	vars := mux.Vars(r)
+	_, err := c.TriggerList().Get(vars["trigger"])
+	if err != nil {
+		return http.StatusNotFound, err.Error()
+	}
+	count, err := countValue(r, 5)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	times, err := c.Executor().NextFires(vars["trigger"], count)
+	if err != nil {
+		return http.StatusConflict, err.Error()
+	}
+	return http.StatusOK, times
+}
+
+// Lists the jobs the triggers start between from and to, by default over
+// the next day.
+func getCalendar(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	from := time.Now()
+	if value := r.FormValue("from"); value != "" {
+		var err error
+		from, err = parseTime(value)
+		if err != nil {
+			return http.StatusBadRequest, "Invalid 'from', expected a date or an RFC 3339 time"
+		}
+	}
+	to := from.AddDate(0, 0, 1)
+	if value := r.FormValue("to"); value != "" {
+		var err error
+		to, err = parseTime(value)
+		if err != nil {
+			return http.StatusBadRequest, "Invalid 'to', expected a date or an RFC 3339 time"
+		}
+	}
+	if !to.After(from) {
+		return http.StatusBadRequest, "'to' must be after 'from'"
+	}
+	return http.StatusOK, c.Executor().Calendar(from, to)
+}
+
+// Parses a cron expression and returns the next times it fires.
+func validateSchedule(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	count, err := countValue(r, 5)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	times, err := UpcomingTimes(r.FormValue("schedule"), time.Now(), count)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	return http.StatusOK, times
+}
+
+// Starts the jobs attached to a webhook trigger once the signature of the
+// request is checked, unless the event doesn't pass the filters of the
+// trigger.
+func receiveHook(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	vars := mux.Vars(r)
+	trigger, err := c.TriggerList().Get(vars["trigger"])
+	if err != nil {
+		return http.StatusNotFound, err.Error()
+	}
+	t := trigger.(Trigger)
+	if t.Type != WebhookTrigger {
+		return http.StatusNotFound, fmt.Sprintf("Trigger '%s' is not a webhook", t.Name)
+	}
+	payload, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, MaxPayloadSize))
+	if err != nil {
+		return http.StatusRequestEntityTooLarge, err.Error()
+	}
+	var secret string
+	if t.Secret != "" {
+		secret, err = c.SecretList().Reveal(t.Secret)
+		if err != nil {
+			return http.StatusInternalServerError, err.Error()
+		}
+	}
+	err = VerifySignature(secret, payload, Signature(r.Header))
+	if err != nil {
+		return http.StatusUnauthorized, err.Error()
+	}
+	event, err := ParseEvent(t.Name, r.Header, payload)
+	if err != nil {
+		return http.StatusBadRequest, err.Error()
+	}
+	if event == nil || !t.Matches(event) {
+		return http.StatusOK, map[string][]string{"runs": {}}
+	}
+	return http.StatusAccepted, map[string][]string{"runs": c.Executor().Hook(t, event)}
+}
+
+// Returns the branch heads last seen by a polling trigger.
+func getPollState(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
+	vars := mux.Vars(r)
+	_, err := c.TriggerList().Get(vars["trigger"])
+	if err != nil {
+		return http.StatusNotFound, err.Error()
+	}
+	state, err := c.Executor().PollState(vars["trigger"])
+	if err != nil {
+		return http.StatusNotFound, err.Error()
+	}
+	return http.StatusOK, state
+}
+
 func listJobsForTrigger(c context, w http.ResponseWriter, r *http.Request) (int, interface{}) {
 	vars := mux.Vars(r)
 	jobs := c.JobList().GetJobsWithTrigger(vars["trigger"])
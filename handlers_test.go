@@ -1,11 +1,18 @@
 package main
 
 import (
+	"io/ioutil"
+	"math/rand"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/gorilla/mux"
 	"github.com/lirios/ci/service"
 )
 
@@ -29,3 +36,81 @@ func TestResponses(t *testing.T) {
 		t.Errorf("Expected %v; got %v", http.StatusOK, status)
 	}
 }
+
+func TestDownloadArtifactsZip(t *testing.T) {
+	root, err := ioutil.TempDir("", "handlers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	settings := &service.Settings{}
+	settings.Server.OutputPath = root
+	runList := service.NewRunList(root, service.NewNotifier(settings), service.NewJobList(root), nil)
+	c := ctx{settings: settings, runList: runList}
+	router := mux.NewRouter()
+	router.Handle("/runs/{run}/artifacts.zip", rawHandler{&c, downloadArtifactsZip})
+
+	// The first artifact is large enough for the archive to be sent
+	// before the missing one is found
+	os.MkdirAll(service.ArtifactsPath(settings, "run"), os.ModePerm)
+	big := make([]byte, 64*1024)
+	rand.Read(big)
+	ioutil.WriteFile(filepath.Join(service.ArtifactsPath(settings, "run"), "big"), big, 0644)
+	runList.Append(service.Run{UUID: "run", Artifacts: []service.Artifact{{Path: "big"}, {Path: "missing"}}})
+	runList.Append(service.Run{UUID: "empty", Artifacts: []service.Artifact{{Path: "missing"}}})
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/runs/run/artifacts.zip", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Body.String(), "PK") || strings.Contains(w.Body.String(), "no such file") {
+		t.Errorf("Expected a truncated archive without error text, got %d %q", w.Code, w.Body.String()[:2])
+	}
+
+	w = httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest("GET", "/runs/empty/artifacts.zip", nil))
+	if w.Code != http.StatusInternalServerError || w.Header().Get("Content-Disposition") != "" {
+		t.Errorf("Expected an error before the archive is sent, got %d %v", w.Code, w.Header())
+	}
+}
+
+func TestRejectedJobTaskChange(t *testing.T) {
+	root, err := ioutil.TempDir("", "handlers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	taskList := service.NewTaskList(root)
+	for _, name := range []string{"a", "b", "c"} {
+		taskList.Append(service.Task{Name: name})
+	}
+	jobList := service.NewJobList(root)
+	stored := []service.JobTask{{Name: "a"}, {Name: "b", Needs: []string{"a"}}, {Name: "c"}}
+	jobList.Append(service.Job{Name: "job", Tasks: append([]service.JobTask(nil), stored...)})
+	c := ctx{jobList: jobList, taskList: taskList}
+
+	// The status is kept aside, appHandler always answers 200
+	var code int
+	handle := func(handler func(context, http.ResponseWriter, *http.Request) (int, interface{})) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) { code, _ = handler(c, w, r) }
+	}
+	router := mux.NewRouter()
+	router.Handle("/jobs/{job}/tasks/{task}", handle(updateTaskOfJob)).Methods("PUT")
+	router.Handle("/jobs/{job}/tasks/{task}", handle(removeTaskFromJob)).Methods("DELETE")
+
+	for _, request := range []struct {
+		method, uri, body string
+		code              int
+	}{
+		// b needs a
+		{"DELETE", "/jobs/job/tasks/0", "", http.StatusBadRequest},
+		{"PUT", "/jobs/job/tasks/2", `{"needs": ["zzz"]}`, http.StatusBadRequest},
+		{"DELETE", "/jobs/job/tasks/3", "", http.StatusNotFound},
+	} {
+		router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(request.method, request.uri, strings.NewReader(request.body)))
+		if code != request.code {
+			t.Errorf("%s %s: expected %d, got %d", request.method, request.uri, request.code, code)
+		}
+		if job, _ := jobList.Get("job"); !reflect.DeepEqual(job.(service.Job).Tasks, stored) {
+			t.Errorf("%s %s: rejected change altered the job: %v", request.method, request.uri, job.(service.Job).Tasks)
+		}
+	}
+}
@@ -19,8 +19,10 @@ var routes = []struct {
 	{"/jobs", listJobs, "GET"},
 	{"/jobs", addJob, "POST"},
 	{"/jobs/{job}", getJob, "GET"},
+	{"/jobs/{job}", updateJob, "PUT"},
 	{"/jobs/{job}", deleteJob, "DELETE"},
 	{"/jobs/{job}/tasks", addTaskToJob, "POST"},
+	{"/jobs/{job}/tasks/{task}", updateTaskOfJob, "PUT"},
 	{"/jobs/{job}/tasks/{task}", removeTaskFromJob, "DELETE"},
 	{"/jobs/{job}/triggers", addTriggerToJob, "POST"},
 	{"/jobs/{job}/triggers/{trigger}", removeTriggerFromJob, "DELETE"},
@@ -31,10 +33,31 @@ var routes = []struct {
 	{"/tasks/{task}", updateTask, "PUT"},
 	{"/tasks/{task}", deleteTask, "DELETE"},
 	{"/tasks/{task}/jobs", listJobsForTask, "GET"},
+	{"/tasks/{task}/revisions", listTaskRevisions, "GET"},
+	{"/tasks/{task}/revisions/{revision}", getTaskRevision, "GET"},
+	{"/tasks/{task}/revisions/{revision}/restore", restoreTaskRevision, "POST"},
+	{"/tasks/{task}/diff", diffTaskRevisions, "GET"},
 
 	{"/runs", listRuns, "GET"},
 	{"/runs", addRun, "POST"},
 	{"/runs/{run}", getRun, "GET"},
+	{"/runs/{run}/cancel", cancelRun, "POST"},
+	{"/runs/{run}/rerun", rerunRun, "POST"},
+	{"/runs/{run}/artifacts", listArtifacts, "GET"},
+	{"/runs/{run}/logs/{log}", getLog, "GET"},
+
+	{"/search/logs", searchLogs, "GET"},
+
+	{"/export", exportPipeline, "GET"},
+	{"/import", importPipeline, "POST"},
+
+	{"/queue", listQueue, "GET"},
+	{"/housekeeping", getHousekeeping, "GET"},
+	{"/queue/{run}", removeFromQueue, "DELETE"},
+
+	{"/secrets", listSecrets, "GET"},
+	{"/secrets/{secret}", setSecret, "PUT"},
+	{"/secrets/{secret}", deleteSecret, "DELETE"},
 
 	{"/triggers", listTriggers, "GET"},
 	{"/triggers", addTrigger, "POST"},
@@ -42,6 +65,26 @@ var routes = []struct {
 	{"/triggers/{trigger}", updateTrigger, "PUT"},
 	{"/triggers/{trigger}", deleteTrigger, "DELETE"},
 	{"/triggers/{trigger}/jobs", listJobsForTrigger, "GET"},
+	{"/triggers/{trigger}/next", listNextFires, "GET"},
+	{"/triggers/{trigger}/heads", getPollState, "GET"},
+
+	{"/hooks/{trigger}", receiveHook, "POST"},
+
+	{"/cron", listArmedTriggers, "GET"},
+	{"/cron/calendar", getCalendar, "GET"},
+	{"/cron/validate", validateSchedule, "GET"},
+}
+
+// Routes writing their own response instead of JSON, such as downloads
+var rawRoutes = []struct {
+	route   string
+	handler func(context, http.ResponseWriter, *http.Request) (int, error)
+	method  string
+}{
+	{"/runs/{run}/artifacts.zip", downloadArtifactsZip, "GET"},
+	{"/runs/{run}/artifacts/{artifact:.+}", downloadArtifact, "GET"},
+	{"/runs/{run}/logs/{log}/text", getLogText, "GET"},
+	{"/runs/{run}/payload", getPayload, "GET"},
 }
 
 type ctx struct {
@@ -52,6 +95,8 @@ type ctx struct {
 	taskList    *TaskList
 	triggerList *TriggerList
 	runList     *RunList
+	secretList  *SecretList
+	revisions   *RevisionList
 }
 
 func (t ctx) Settings() *Settings {
@@ -82,6 +127,14 @@ func (t ctx) RunList() *RunList {
 	return t.runList
 }
 
+func (t ctx) SecretList() *SecretList {
+	return t.secretList
+}
+
+func (t ctx) RevisionList() *RevisionList {
+	return t.revisions
+}
+
 type context interface {
 	Settings() *Settings
 	Hub() *Hub
@@ -90,6 +143,8 @@ type context interface {
 	TaskList() *TaskList
 	TriggerList() *TriggerList
 	RunList() *RunList
+	SecretList() *SecretList
+	RevisionList() *RevisionList
 }
 
 type appHandler struct {
@@ -105,6 +160,19 @@ func (t appHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	log.Println(r.URL, "-", r.Method, "-", code, r.RemoteAddr)
 }
 
+type rawHandler struct {
+	*ctx
+	handler func(context, http.ResponseWriter, *http.Request) (int, error)
+}
+
+func (t rawHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	code, err := t.handler(t.ctx, w, r)
+	if err != nil {
+		http.Error(w, err.Error(), code)
+	}
+	log.Println(r.URL, "-", r.Method, "-", code, r.RemoteAddr)
+}
+
 func main() {
 	wd, _ := os.Getwd()
 	log.Println("Working directory", wd)
@@ -130,19 +198,25 @@ func main() {
 	jobList := NewJobList(settings.Server.DbRootPath)
 	taskList := NewTaskList(settings.Server.DbRootPath)
 	triggerList := NewTriggerList(settings.Server.DbRootPath)
-	runList := NewRunList(settings.Server.DbRootPath, notifier, jobList)
+	secretList := NewSecretList(settings.Server.DbRootPath, settings.Secrets.Key)
+	revisionList := NewRevisionList(settings.Server.DbRootPath)
+	pollList := NewPollList(settings.Server.DbRootPath)
+	runList := NewRunList(settings.Server.DbRootPath, notifier, jobList, secretList)
 
 	jobList.Load()
 	taskList.Load()
 	triggerList.Load()
+	secretList.Load()
+	revisionList.Load()
 	runList.Load()
+	pollList.Load()
 
-	hub := NewHub(runList)
-	go hub.HubLoop()
+	executor := NewExecutor(&settings, notifier, jobList, taskList, triggerList, runList, pollList)
 
-	executor := NewExecutor(&settings, notifier, jobList, taskList, runList)
+	hub := NewHub(runList, executor)
+	go hub.HubLoop()
 
-	appContext := &ctx{&settings, hub, executor, jobList, taskList, triggerList, runList}
+	appContext := &ctx{&settings, hub, executor, jobList, taskList, triggerList, runList, secretList, revisionList}
 
 	r := mux.NewRouter()
 
@@ -155,6 +229,9 @@ func main() {
 	for _, detail := range routes {
 		r.Handle(detail.route, appHandler{appContext, detail.handler}).Methods(detail.method)
 	}
+	for _, detail := range rawRoutes {
+		r.Handle(detail.route, rawHandler{appContext, detail.handler}).Methods(detail.method)
+	}
 
 	log.Println("Running on " + settings.Server.Port)
 	http.ListenAndServe(settings.Server.Port, r)
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A file produced by a task and kept with the run.
+type Artifact struct {
+	// Path relative to the workspace, with forward slashes
+	Path string `json:"path"`
+	// Name of the task that produced it
+	Task   string `json:"task"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Returns the directory holding the artifacts of a run.
+func ArtifactsPath(settings *Settings, UUID string) string {
+	return filepath.Join(settings.Server.OutputPath, "files", "artifacts", UUID)
+}
+
+// Checks the artifact patterns of a task, they are relative to the
+// workspace and cannot leave it.
+func ValidateArtifacts(patterns []string) error {
+	for _, pattern := range patterns {
+		if pattern == "" || filepath.IsAbs(pattern) {
+			return fmt.Errorf("Invalid artifact pattern '%s'", pattern)
+		}
+		for _, part := range strings.Split(filepath.ToSlash(pattern), "/") {
+			if part == ".." {
+				return fmt.Errorf("Artifact pattern '%s' is outside of the workspace", pattern)
+			}
+		}
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid artifact pattern '%s': %s", pattern, err)
+		}
+	}
+	return nil
+}
+
+// Copies the files matching the artifact patterns of a task from the
+// workspace to the artifacts directory of the run, matching directories
+// are copied with their content.
+func collectArtifacts(settings *Settings, r *Run, task Task) ([]Artifact, error) {
+	var artifacts []Artifact
+	seen := map[string]bool{}
+	for _, pattern := range task.Artifacts {
+		matches, err := filepath.Glob(filepath.Join(r.Workspace, pattern))
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			err = filepath.Walk(match, func(path string, info os.FileInfo, err error) error {
+				if err != nil || !info.Mode().IsRegular() {
+					return err
+				}
+				rel, err := filepath.Rel(r.Workspace, path)
+				if err != nil {
+					return err
+				}
+				rel = filepath.ToSlash(rel)
+				if seen[rel] {
+					return nil
+				}
+				seen[rel] = true
+				artifact, err := copyArtifact(path, filepath.Join(ArtifactsPath(settings, r.UUID), rel))
+				if err != nil {
+					return err
+				}
+				artifact.Path = rel
+				artifact.Task = task.Name
+				artifacts = append(artifacts, artifact)
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return artifacts, nil
+}
+
+func copyArtifact(src, dst string) (Artifact, error) {
+	var artifact Artifact
+	in, err := os.Open(src)
+	if err != nil {
+		return artifact, err
+	}
+	defer in.Close()
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return artifact, err
+	}
+	out, err := os.Create(dst)
+	if err != nil {
+		return artifact, err
+	}
+	defer out.Close()
+
+	hash := sha256.New()
+	artifact.Size, err = io.Copy(io.MultiWriter(out, hash), in)
+	if err != nil {
+		return artifact, err
+	}
+	artifact.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return artifact, out.Close()
+}
+
+// Records artifacts on the run, replacing the ones with the same path.
+func (r *Run) addArtifacts(artifacts []Artifact) {
+	for _, artifact := range artifacts {
+		replaced := false
+		for i := range r.Artifacts {
+			if r.Artifacts[i].Path == artifact.Path {
+				r.Artifacts[i] = artifact
+				replaced = true
+			}
+		}
+		if !replaced {
+			r.Artifacts = append(r.Artifacts, artifact)
+		}
+	}
+}
+
+// Returns the artifact of the run with the given path.
+func (r Run) Artifact(path string) (Artifact, bool) {
+	for _, artifact := range r.Artifacts {
+		if artifact.Path == path {
+			return artifact, true
+		}
+	}
+	return Artifact{}, false
+}
+
+// Writes the artifacts of a run as a zip archive.
+func WriteArtifactsZip(settings *Settings, r Run, w io.Writer) error {
+	archive := zip.NewWriter(w)
+	for _, artifact := range r.Artifacts {
+		file, err := os.Open(filepath.Join(ArtifactsPath(settings, r.UUID), filepath.FromSlash(artifact.Path)))
+		if err != nil {
+			return err
+		}
+		entry, err := archive.Create(artifact.Path)
+		if err == nil {
+			_, err = io.Copy(entry, file)
+		}
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateArtifacts(t *testing.T) {
+	if err := ValidateArtifacts([]string{"out/*.tar.gz", "report.xml"}); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+	for _, pattern := range []string{"", "/etc/passwd", "../out", "out/../../x", "[a"} {
+		if err := ValidateArtifacts([]string{pattern}); err == nil {
+			t.Errorf("Pattern '%s' should be invalid", pattern)
+		}
+	}
+}
+
+func TestCollectArtifacts(t *testing.T) {
+	root, err := ioutil.TempDir("", "artifacts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	var settings Settings
+	settings.Server.OutputPath = filepath.Join(root, "output")
+	run := &Run{UUID: "uuid", Workspace: filepath.Join(root, "workspace")}
+	os.MkdirAll(filepath.Join(run.Workspace, "out", "sub"), os.ModePerm)
+	ioutil.WriteFile(filepath.Join(run.Workspace, "out", "sub", "a.txt"), []byte("hello"), 0644)
+	ioutil.WriteFile(filepath.Join(run.Workspace, "b.log"), []byte(""), 0644)
+
+	task := Task{Name: "task", Artifacts: []string{"out", "*.log", "out/sub/*", "missing"}}
+	artifacts, err := collectArtifacts(&settings, run, task)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(artifacts) != 2 {
+		t.Fatalf("Expected 2 artifacts, got %v", artifacts)
+	}
+	a := artifacts[0]
+	if a.Path != "out/sub/a.txt" || a.Task != "task" || a.Size != 5 ||
+		a.SHA256 != "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824" {
+		t.Errorf("Unexpected artifact %v", a)
+	}
+	data, err := ioutil.ReadFile(filepath.Join(ArtifactsPath(&settings, "uuid"), "out", "sub", "a.txt"))
+	if err != nil || string(data) != "hello" {
+		t.Errorf("Artifact not copied: %v", err)
+	}
+}
@@ -7,10 +7,14 @@ import (
 )
 
 const (
-	jobsFile     = "jobs.json"
-	runsFile     = "runs.json"
-	tasksFile    = "tasks.json"
-	triggersFile = "triggers.json"
+	jobsFile      = "jobs.json"
+	runsFile      = "runs.json"
+	tasksFile     = "tasks.json"
+	triggersFile  = "triggers.json"
+	secretsFile   = "secrets.json"
+	revisionsFile = "revisions.json"
+	logIndexFile  = "logindex.jsonl"
+	pollsFile     = "polls.json"
 )
 
 type ListWriter func([]byte, string)
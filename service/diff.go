@@ -0,0 +1,140 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Number of unchanged lines shown around the changes of a diff.
+const diffContext = 3
+
+// Kinds of lines of a diff.
+const (
+	lineEqual   = ' '
+	lineAdded   = '+'
+	lineRemoved = '-'
+)
+
+type diffLine struct {
+	kind byte
+	text string
+	// Line numbers in the old and the new text, starting from 1
+	old, new int
+}
+
+// Returns the unified diff between two texts, empty when they are equal.
+func unifiedDiff(oldName, newName, oldText, newText string) string {
+	lines := diffLines(splitLines(oldText), splitLines(newText))
+	var out strings.Builder
+	for start := 0; start < len(lines); {
+		// Find the next change and the end of its hunk
+		first := start
+		for first < len(lines) && lines[first].kind == lineEqual {
+			first++
+		}
+		if first == len(lines) {
+			break
+		}
+		last := first
+		for i := first; i < len(lines); i++ {
+			if lines[i].kind != lineEqual {
+				last = i
+			} else if i-last > 2*diffContext+1 {
+				break
+			}
+		}
+		from := first - diffContext
+		if from < start {
+			from = start
+		}
+		to := last + diffContext + 1
+		if to > len(lines) {
+			to = len(lines)
+		}
+
+		if out.Len() == 0 {
+			fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+		}
+		oldStart, oldCount, newStart, newCount := hunkRange(lines[from:to])
+		fmt.Fprintf(&out, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+		for _, line := range lines[from:to] {
+			out.WriteByte(line.kind)
+			out.WriteString(line.text)
+			out.WriteByte('\n')
+		}
+		start = to
+	}
+	return out.String()
+}
+
+// Returns the first line and the number of lines of a hunk in the old and
+// the new texts.
+func hunkRange(lines []diffLine) (oldStart, oldCount, newStart, newCount int) {
+	for _, line := range lines {
+		if line.kind != lineAdded {
+			if oldCount == 0 {
+				oldStart = line.old
+			}
+			oldCount++
+		}
+		if line.kind != lineRemoved {
+			if newCount == 0 {
+				newStart = line.new
+			}
+			newCount++
+		}
+	}
+	// Empty ranges start at the line before them
+	if oldCount == 0 {
+		oldStart = lines[0].old - 1
+	}
+	if newCount == 0 {
+		newStart = lines[0].new - 1
+	}
+	return
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// Aligns two lists of lines along their longest common subsequence.
+func diffLines(a, b []string) []diffLine {
+	// lcs[i][j] is the length of the common subsequence of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		switch {
+		case i < len(a) && j < len(b) && a[i] == b[j]:
+			lines = append(lines, diffLine{lineEqual, a[i], i + 1, j + 1})
+			i++
+			j++
+		case j == len(b) || (i < len(a) && lcs[i+1][j] >= lcs[i][j+1]):
+			lines = append(lines, diffLine{lineRemoved, a[i], i + 1, j + 1})
+			i++
+		default:
+			lines = append(lines, diffLine{lineAdded, b[j], i + 1, j + 1})
+			j++
+		}
+	}
+	return lines
+}
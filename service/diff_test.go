@@ -0,0 +1,38 @@
+package service
+
+import (
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	old := "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n"
+	new := "1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n14\n15\n16\n"
+	expected := `--- a
++++ b
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -10,6 +10,6 @@
+ 10
+ 11
+ 12
+-13
+ 14
+ 15
++16
+`
+	if diff := unifiedDiff("a", "b", old, new); diff != expected {
+		t.Errorf("Unexpected diff:\n%s", diff)
+	}
+	if diff := unifiedDiff("a", "b", "", "x\n"); diff != "--- a\n+++ b\n@@ -0,0 +1,1 @@\n+x\n" {
+		t.Errorf("Unexpected diff of new text:\n%s", diff)
+	}
+	if diff := unifiedDiff("a", "b", old, old); diff != "" {
+		t.Errorf("Equal texts should have no diff:\n%s", diff)
+	}
+}
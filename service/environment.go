@@ -0,0 +1,99 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const redacted = "********"
+
+// Variables whose name matches are considered sensitive and never shown.
+var sensitiveName = regexp.MustCompile("(?i)(SECRET|TOKEN|PASSWORD|PASSWD|CREDENTIAL|KEY)")
+
+// Builds the environment of a task. Each layer overrides the previous ones:
+//
+//  1. variables of the server process listed in [Environment] Inherit
+//  2. global variables from [Environment] Variable
+//  3. job variables
+//  4. task variables
+//  5. secrets of the job
+//  6. job parameters, as LIRICI_PARAM_<NAME>
+//  7. the LIRICI_* variables describing the run and the event that
+//     started it, HOME and TMPDIR
+func taskEnvironment(settings *Settings, r *Run, task Task, secrets map[string]string) map[string]string {
+	env := make(map[string]string)
+	for _, name := range settings.Environment.Inherit {
+		if value, found := os.LookupEnv(name); found {
+			env[name] = value
+		}
+	}
+	for _, variable := range settings.Environment.Variable {
+		parts := strings.SplitN(variable, "=", 2)
+		if len(parts) != 2 || !identifier.MatchString(parts[0]) {
+			log.Printf("Ignoring invalid environment variable '%s'\n", variable)
+			continue
+		}
+		env[parts[0]] = parts[1]
+	}
+	for name, value := range r.Job.Env {
+		env[name] = value
+	}
+	for name, value := range task.Env {
+		env[name] = value
+	}
+	for name, value := range secrets {
+		env[name] = value
+	}
+	for name, value := range parametersEnv(r.Parameters) {
+		env[name] = value
+	}
+	for name, value := range r.Event.env() {
+		env[name] = value
+	}
+	env["LIRICI_UUID"] = r.UUID
+	env["LIRICI_JOB_NAME"] = r.Job.ID()
+	env["LIRICI_TASK_NAME"] = task.Name
+	env["LIRICI_OUTPUT_DIR"] = settings.Server.OutputPath
+	w := runWorkspace(settings, r)
+	env["LIRICI_WORKSPACE"] = w.Dir
+	env["HOME"] = w.Home
+	env["TMPDIR"] = w.Tmp
+	return env
+}
+
+// Returns the environment in the NAME=value form expected by exec.Cmd.
+func envList(env map[string]string) []string {
+	list := make([]string, 0, len(env))
+	for name, value := range env {
+		list = append(list, name+"="+value)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Returns a copy of the environment where secrets and other sensitive
+// values are hidden.
+func redactEnv(env map[string]string, secrets map[string]string) map[string]string {
+	shown := make(map[string]string)
+	for name, value := range env {
+		if _, secret := secrets[name]; secret || sensitiveName.MatchString(name) {
+			value = redacted
+		}
+		shown[name] = value
+	}
+	return shown
+}
+
+// Checks that the names of the variables can be used in an environment.
+func ValidateEnv(env map[string]string) error {
+	for name := range env {
+		if !identifier.MatchString(name) {
+			return fmt.Errorf("Invalid environment variable name '%s'", name)
+		}
+	}
+	return nil
+}
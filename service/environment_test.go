@@ -0,0 +1,57 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTaskEnvironment(t *testing.T) {
+	os.Setenv("LIRICI_TEST_INHERITED", "server")
+	os.Setenv("LIRICI_TEST_HIDDEN", "server")
+	var settings Settings
+	settings.Server.OutputPath = "output/"
+	settings.Workspace.Path = "workspaces"
+	settings.Environment.Inherit = []string{"LIRICI_TEST_INHERITED"}
+	settings.Environment.Variable = []string{"GLOBAL=global", "JOB=global", "invalid"}
+
+	task := Task{Name: "task", Env: map[string]string{"TASK": "task", "API_TOKEN": "s3cr3t"}}
+	root, _ := filepath.Abs("workspaces")
+	run := &Run{
+		UUID:       "uuid",
+		Job:        Job{Name: "job", Env: map[string]string{"JOB": "job", "TASK": "job"}},
+		Parameters: map[string]string{"branch": "master"},
+	}
+	env := taskEnvironment(&settings, run, task, map[string]string{"DEPLOY_KEY": "k3y", "SIGNER": "me"})
+
+	expected := map[string]string{
+		"LIRICI_TEST_INHERITED": "server",
+		"GLOBAL":                "global",
+		"JOB":                   "job",
+		"TASK":                  "task",
+		"API_TOKEN":             "s3cr3t",
+		"DEPLOY_KEY":            "k3y",
+		"SIGNER":                "me",
+		"LIRICI_PARAM_BRANCH":   "master",
+		"LIRICI_UUID":           "uuid",
+		"LIRICI_JOB_NAME":       "job",
+		"LIRICI_TASK_NAME":      "task",
+		"LIRICI_OUTPUT_DIR":     "output/",
+		"LIRICI_WORKSPACE":      filepath.Join(root, "runs", "uuid", "workspace"),
+		"HOME":                  filepath.Join(root, "runs", "uuid", "home"),
+		"TMPDIR":                filepath.Join(root, "runs", "uuid", "tmp"),
+	}
+	if len(env) != len(expected) {
+		t.Errorf("Expected %v but got %v", expected, env)
+	}
+	for name, value := range expected {
+		if env[name] != value {
+			t.Errorf("Expected %s=%s but got %s", name, value, env[name])
+		}
+	}
+
+	shown := redactEnv(env, map[string]string{"SIGNER": "me"})
+	if shown["API_TOKEN"] != redacted || shown["SIGNER"] != redacted || shown["TASK"] != "task" {
+		t.Errorf("Unexpected redacted environment %v", shown)
+	}
+}
@@ -0,0 +1,227 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of forge events understood by webhook triggers.
+const (
+	PushEvent        = "push"
+	TagEvent         = "tag"
+	PullRequestEvent = "pull_request"
+)
+
+// Headers naming the event of a request sent by GitHub or by a forge
+// compatible with it, such as Gitea.
+var eventHeaders = []string{"X-Gitea-Event", "X-GitHub-Event"}
+
+// Header carrying the hex HMAC-SHA256 of the body of a Gitea request.
+const GiteaSignatureHeader = "X-Gitea-Signature"
+
+// Returns the signature of a webhook request, whichever forge sent it.
+func Signature(header http.Header) string {
+	if signature := header.Get(SignatureHeader); signature != "" {
+		return signature
+	}
+	return header.Get(GiteaSignatureHeader)
+}
+
+type pushPayload struct {
+	Ref     string `json:"ref"`
+	Before  string `json:"before"`
+	After   string `json:"after"`
+	Deleted bool   `json:"deleted"`
+	Commits []struct {
+		Added    []string `json:"added"`
+		Removed  []string `json:"removed"`
+		Modified []string `json:"modified"`
+	} `json:"commits"`
+}
+
+type pullRequestPayload struct {
+	Action      string `json:"action"`
+	Number      int    `json:"number"`
+	PullRequest struct {
+		Head struct {
+			Ref string `json:"ref"`
+			SHA string `json:"sha"`
+		} `json:"head"`
+		Base struct {
+			Ref string `json:"ref"`
+		} `json:"base"`
+	} `json:"pull_request"`
+}
+
+// SHA of the "before" commit of a push creating a branch.
+const zeroSHA = "0000000000000000000000000000000000000000"
+
+// Builds the event of a webhook request. Requests that don't come from a
+// forge give an event with only the payload. Forge events that don't ask
+// for a build, such as pings or closed pull requests, give nil.
+func ParseEvent(trigger string, header http.Header, payload []byte) (*Event, error) {
+	event := &Event{Trigger: trigger, Received: time.Now(), PayloadSize: len(payload), payload: payload}
+	var name string
+	for _, h := range eventHeaders {
+		if name = header.Get(h); name != "" {
+			break
+		}
+	}
+
+	switch name {
+	case "":
+		return event, nil
+	case "push":
+		var p pushPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return nil, fmt.Errorf("Invalid push payload: %v", err)
+		}
+		if p.Deleted || p.After == zeroSHA {
+			return nil, nil
+		}
+		event.Ref, event.SHA = p.Ref, p.After
+		if p.Before != zeroSHA {
+			event.Before = p.Before
+		}
+		switch {
+		case strings.HasPrefix(p.Ref, "refs/heads/"):
+			event.Kind, event.Branch = PushEvent, strings.TrimPrefix(p.Ref, "refs/heads/")
+		case strings.HasPrefix(p.Ref, "refs/tags/"):
+			event.Kind, event.Tag = TagEvent, strings.TrimPrefix(p.Ref, "refs/tags/")
+		default:
+			return nil, nil
+		}
+		seen := make(map[string]bool)
+		for _, commit := range p.Commits {
+			for _, files := range [][]string{commit.Added, commit.Removed, commit.Modified} {
+				for _, file := range files {
+					if !seen[file] {
+						seen[file] = true
+						event.Files = append(event.Files, file)
+					}
+				}
+			}
+		}
+	case "pull_request":
+		var p pullRequestPayload
+		if err := json.Unmarshal(payload, &p); err != nil {
+			return nil, fmt.Errorf("Invalid pull request payload: %v", err)
+		}
+		switch p.Action {
+		case "opened", "reopened", "synchronize", "synchronized":
+		default:
+			return nil, nil
+		}
+		event.Kind = PullRequestEvent
+		event.PullRequest = p.Number
+		event.Ref = "refs/pull/" + strconv.Itoa(p.Number) + "/head"
+		event.SHA = p.PullRequest.Head.SHA
+		event.Branch = p.PullRequest.Base.Ref
+	default:
+		return nil, nil
+	}
+	return event, nil
+}
+
+// Tells whether an event passes the filters of a trigger. Requests that
+// are not forge events only pass a trigger without filters. Branch
+// patterns match the branch pushed to or the base branch of a pull
+// request, path patterns match the files changed by a push.
+func (t Trigger) Matches(e *Event) bool {
+	if e.Kind == "" {
+		return len(t.Events)+len(t.Branches)+len(t.Tags)+len(t.Paths) == 0
+	}
+	if len(t.Events) > 0 && !contains(t.Events, e.Kind) {
+		return false
+	}
+	switch e.Kind {
+	case PushEvent, PullRequestEvent:
+		if len(t.Branches) > 0 && !matchAny(t.Branches, e.Branch) {
+			return false
+		}
+	case TagEvent:
+		if len(t.Tags) > 0 && !matchAny(t.Tags, e.Tag) {
+			return false
+		}
+	}
+	if len(t.Paths) > 0 && e.Kind == PushEvent {
+		matched := false
+		for _, file := range e.Files {
+			if matchAny(t.Paths, file) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks the event kinds and the patterns of a trigger.
+func ValidateEventFilters(t Trigger) error {
+	for _, kind := range t.Events {
+		if kind != PushEvent && kind != TagEvent && kind != PullRequestEvent {
+			return fmt.Errorf("Unknown event '%s'", kind)
+		}
+	}
+	for _, patterns := range [][]string{t.Branches, t.Tags, t.Paths} {
+		for _, pattern := range patterns {
+			if pattern == "" {
+				return fmt.Errorf("Empty pattern")
+			}
+		}
+	}
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if globRegexp(pattern).MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Converts a glob to a regular expression: * and ? don't match slashes,
+// ** matches any number of directories.
+func globRegexp(pattern string) *regexp.Regexp {
+	var expr strings.Builder
+	expr.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**/") {
+				expr.WriteString("(.*/)?")
+				i += 2
+			} else if strings.HasPrefix(pattern[i:], "**") {
+				expr.WriteString(".*")
+				i++
+			} else {
+				expr.WriteString("[^/]*")
+			}
+		case '?':
+			expr.WriteString("[^/]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	expr.WriteString("$")
+	return regexp.MustCompile(expr.String())
+}
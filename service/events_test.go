@@ -0,0 +1,83 @@
+package service
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestParsePushEvent(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-GitHub-Event", "push")
+	payload := `{"ref": "refs/heads/main", "before": "1111", "after": "2222",
+		"commits": [{"added": ["docs/index.md"], "modified": ["main.go"]}, {"modified": ["main.go"]}]}`
+	event, err := ParseEvent("push", header, []byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Kind != PushEvent || event.Branch != "main" || event.SHA != "2222" || event.Before != "1111" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	if !reflect.DeepEqual(event.Files, []string{"docs/index.md", "main.go"}) {
+		t.Errorf("Unexpected files %v", event.Files)
+	}
+	env := event.env()
+	if env["LIRICI_COMMIT_SHA"] != "2222" || env["LIRICI_BRANCH"] != "main" || env["LIRICI_REF"] != "refs/heads/main" {
+		t.Errorf("Unexpected environment %v", env)
+	}
+
+	header.Set("X-GitHub-Event", "ping")
+	if event, _ := ParseEvent("push", header, []byte(`{}`)); event != nil {
+		t.Errorf("Ping should not give an event, got %+v", event)
+	}
+}
+
+func TestParsePullRequestEvent(t *testing.T) {
+	header := http.Header{}
+	header.Set("X-Gitea-Event", "pull_request")
+	payload := `{"action": "synchronized", "number": 7,
+		"pull_request": {"head": {"ref": "fix", "sha": "3333"}, "base": {"ref": "main"}}}`
+	event, err := ParseEvent("pr", header, []byte(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Kind != PullRequestEvent || event.PullRequest != 7 || event.SHA != "3333" || event.Branch != "main" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	if event.env()["LIRICI_PR_NUMBER"] != "7" {
+		t.Errorf("Unexpected environment %v", event.env())
+	}
+
+	if event, _ := ParseEvent("pr", header, []byte(`{"action": "closed", "number": 7}`)); event != nil {
+		t.Errorf("Closed pull request should not give an event, got %+v", event)
+	}
+}
+
+func TestTriggerMatches(t *testing.T) {
+	trigger := Trigger{
+		Events:   []string{PushEvent, TagEvent},
+		Branches: []string{"main", "release/*"},
+		Tags:     []string{"v*"},
+		Paths:    []string{"**/*.go"},
+	}
+	for _, c := range []struct {
+		event   Event
+		matches bool
+	}{
+		{Event{Kind: PushEvent, Branch: "main", Files: []string{"service/runs.go"}}, true},
+		{Event{Kind: PushEvent, Branch: "release/1.0", Files: []string{"main.go"}}, true},
+		{Event{Kind: PushEvent, Branch: "release/1.0/fix", Files: []string{"main.go"}}, false},
+		{Event{Kind: PushEvent, Branch: "main", Files: []string{"README.md"}}, false},
+		{Event{Kind: TagEvent, Tag: "v1.2"}, true},
+		{Event{Kind: TagEvent, Tag: "nightly"}, false},
+		{Event{Kind: PullRequestEvent, Branch: "main"}, false},
+		{Event{}, false},
+	} {
+		if trigger.Matches(&c.event) != c.matches {
+			t.Errorf("Expected %+v to match: %v", c.event, c.matches)
+		}
+	}
+	if !(Trigger{}).Matches(&Event{}) {
+		t.Error("Trigger without filters should match any request")
+	}
+}
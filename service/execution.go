@@ -0,0 +1,157 @@
+package service
+
+import (
+	"errors"
+	"log"
+	"os/exec"
+	"sync"
+	"time"
+)
+
+// Time given to a timed out task to exit after SIGTERM before it is killed.
+var killGracePeriod = 10 * time.Second
+
+var (
+	errCancelled = errors.New("Cancelled")
+	errTimedOut  = errors.New("TimedOut")
+	// Set on the runs that were running when the server stopped
+	errInterrupted = errors.New("Interrupted")
+)
+
+// Tracks the processes of a run being executed so that they can be
+// cancelled or stopped when they take too long.
+type execution struct {
+	sync.Mutex
+	cmds map[*exec.Cmd]bool
+	// Why the commands that were signalled have been stopped
+	stops     map[*exec.Cmd]error
+	cancelled bool
+	timedOut  bool
+	// Closed as soon as the run is cancelled or times out
+	done chan struct{}
+}
+
+func newExecution() *execution {
+	return &execution{
+		cmds:  make(map[*exec.Cmd]bool),
+		stops: make(map[*exec.Cmd]error),
+		done:  make(chan struct{}),
+	}
+}
+
+// Starts a command unless the run was stopped. Commands of the tasks that
+// always run are started anyway, they can still be cancelled.
+func (e *execution) start(cmd *exec.Cmd, always bool) error {
+	e.Lock()
+	defer e.Unlock()
+
+	if e.cancelled && !always {
+		return errCancelled
+	}
+	if e.timedOut && !always {
+		return errTimedOut
+	}
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	e.cmds[cmd] = true
+	return nil
+}
+
+// Forgets a command that exited and returns why it was stopped, if it
+// was cancelled or timed out.
+func (e *execution) finish(cmd *exec.Cmd) error {
+	e.Lock()
+	defer e.Unlock()
+
+	reason := e.stops[cmd]
+	delete(e.cmds, cmd)
+	delete(e.stops, cmd)
+	return reason
+}
+
+func (e *execution) cancel() {
+	e.Lock()
+	defer e.Unlock()
+
+	if !e.cancelled && !e.timedOut {
+		close(e.done)
+	}
+	e.cancelled = true
+	for cmd := range e.cmds {
+		e.stops[cmd] = errCancelled
+		if err := killProcessGroup(cmd); err != nil {
+			log.Println("Killing process group:", err)
+		}
+	}
+}
+
+// Terminates a command that took too long, the rest of the run goes on.
+// Nothing happens when the command is already over. When cmd is nil the
+// whole run times out and every command being executed is terminated.
+func (e *execution) timeout(cmd *exec.Cmd) {
+	e.Lock()
+	defer e.Unlock()
+
+	var running []*exec.Cmd
+	if cmd != nil {
+		if !e.cmds[cmd] {
+			return
+		}
+		running = append(running, cmd)
+	} else {
+		if !e.cancelled && !e.timedOut {
+			close(e.done)
+		}
+		e.timedOut = true
+		for c := range e.cmds {
+			running = append(running, c)
+		}
+	}
+	for _, c := range running {
+		if e.stops[c] == nil {
+			e.stops[c] = errTimedOut
+		}
+		if err := terminateProcessGroup(c); err != nil {
+			log.Println("Terminating process group:", err)
+		}
+	}
+	time.AfterFunc(killGracePeriod, func() {
+		e.Lock()
+		defer e.Unlock()
+
+		for _, c := range running {
+			if e.cmds[c] {
+				if err := killProcessGroup(c); err != nil {
+					log.Println("Killing process group:", err)
+				}
+			}
+		}
+	})
+}
+
+// Returns the reason why the run was stopped, if any.
+func (e *execution) stopped() error {
+	e.Lock()
+	defer e.Unlock()
+
+	if e.cancelled {
+		return errCancelled
+	}
+	if e.timedOut {
+		return errTimedOut
+	}
+	return nil
+}
+
+// Sleeps for the given duration, returns early with the reason if the run
+// is stopped in the meantime.
+func (e *execution) wait(d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-e.done:
+		return e.stopped()
+	}
+}
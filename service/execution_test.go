@@ -0,0 +1,315 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Creates a run list keeping its files, logs and workspaces in a
+// temporary directory.
+func newTestRunList(t *testing.T) (*RunList, func()) {
+	root, err := ioutil.TempDir("", "execution")
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := &Settings{}
+	settings.Server.DbRootPath = root
+	settings.Server.OutputPath = root
+	notifier := NewNotifier(settings)
+	go notifier.NotifierLoop()
+	runList := NewRunList(root, notifier, NewJobList(root), NewSecretList(root, ""))
+	go func() {
+		for range runList.logs {
+		}
+	}()
+	return runList, func() { os.RemoveAll(root) }
+}
+
+var testRuns int
+
+// Adds a run of a job whose tasks are given in order, and starts tracking
+// it so that it can be stopped before it is executed.
+func addTestRun(t *testing.T, l *RunList, job Job, tasks ...Task) (string, *execution) {
+	testRuns++
+	UUID := fmt.Sprintf("run-%d", testRuns)
+	for _, task := range tasks {
+		if len(job.Tasks) < len(tasks) {
+			job.Tasks = append(job.Tasks, JobTask{Name: task.Name})
+		}
+	}
+	if err := l.AddRun(UUID, job, tasks, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	return UUID, l.track(UUID)
+}
+
+// Executes a tracked run, failing the test when it doesn't finish in time.
+func executeTestRun(t *testing.T, l *RunList, UUID string, ex *execution) Run {
+	done := make(chan struct{})
+	go func() {
+		l.run(UUID, filepath.Join(l.notifier.settings.Server.OutputPath, "logs"), ex)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(20 * time.Second):
+		t.Fatalf("Run %s did not finish", UUID)
+	}
+	e, err := l.Get(UUID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e.(Run)
+}
+
+func TestCancelBeforeStart(t *testing.T) {
+	l, cleanup := newTestRunList(t)
+	defer cleanup()
+
+	UUID, ex := addTestRun(t, l, Job{Name: "job"},
+		Task{Name: "first", Script: "echo first"},
+		Task{Name: "second", Script: "echo second"})
+	ex.cancel()
+	run := executeTestRun(t, l, UUID, ex)
+	if run.Status != "Cancelled" {
+		t.Errorf("Expected run to be cancelled, got %s", run.Status)
+	}
+	if len(run.Results) != 0 {
+		t.Errorf("No task should have started: %v", run.Results)
+	}
+
+	// A task launched just before the run is cancelled gives up
+	logPath, _ := ioutil.TempDir("", "logs")
+	defer os.RemoveAll(logPath)
+	result := &Result{LogPath: logPath, LogFileName: "first" + logExtension}
+	done := make(chan error)
+	go func() { done <- l.runTask(&run, run.Tasks[0], false, result, ex, func(update func()) { update() }) }()
+	select {
+	case err := <-done:
+		if err != errCancelled {
+			t.Errorf("Expected task to be cancelled, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Task cancelled before it started never returned")
+	}
+}
+
+// Waits until the first task of a run writes its log, that is once its
+// process is started.
+func waitForTask(t *testing.T, l *RunList, UUID string) {
+	for i := 0; i < 200; i++ {
+		if e, err := l.Get(UUID); err == nil && len(e.(Run).Results) > 0 {
+			time.Sleep(100 * time.Millisecond)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("No task of run %s started", UUID)
+}
+
+func TestCancelKillsProcessGroup(t *testing.T) {
+	l, cleanup := newTestRunList(t)
+	defer cleanup()
+
+	// The background sleep keeps the output open, the run can only end
+	// quickly if the whole process group is killed
+	UUID, ex := addTestRun(t, l, Job{Name: "job"},
+		Task{Name: "slow", Script: "sleep 30 & wait"},
+		Task{Name: "next", Script: "echo next"})
+	go func() {
+		waitForTask(t, l, UUID)
+		if err := l.Cancel(UUID); err != nil {
+			t.Error(err)
+		}
+	}()
+	start := time.Now()
+	run := executeTestRun(t, l, UUID, ex)
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Cancelled run took %s", elapsed)
+	}
+	if run.Status != "Cancelled" {
+		t.Errorf("Expected run to be cancelled, got %s", run.Status)
+	}
+	if len(run.Results) != 1 || run.Results[0].Error != errCancelled.Error() || run.Results[0].Signal != "killed" {
+		t.Errorf("Only the slow task should have run, and be killed: %+v", run.Results)
+	}
+	if err := l.Cancel(UUID); err == nil {
+		t.Error("Finished run should not be cancellable")
+	}
+}
+
+func TestJobTimeout(t *testing.T) {
+	l, cleanup := newTestRunList(t)
+	defer cleanup()
+
+	UUID, ex := addTestRun(t, l, Job{Name: "job", Timeout: 1},
+		Task{Name: "slow", Script: "sleep 30"},
+		Task{Name: "next", Script: "echo next"})
+	run := executeTestRun(t, l, UUID, ex)
+	if run.Status != "TimedOut" {
+		t.Errorf("Expected run to time out, got %s", run.Status)
+	}
+	if len(run.Results) != 1 || run.Results[0].Error != errTimedOut.Error() || run.Results[0].Signal != "terminated" {
+		t.Errorf("Only the slow task should have run, and be terminated: %+v", run.Results)
+	}
+}
+
+func TestTaskTimeout(t *testing.T) {
+	l, cleanup := newTestRunList(t)
+	defer cleanup()
+	grace := killGracePeriod
+	killGracePeriod = 500 * time.Millisecond
+	defer func() { killGracePeriod = grace }()
+
+	// SIGTERM is ignored by the shell and by sleep, the task is killed
+	// once the grace period is over
+	job := Job{Name: "job", Tasks: []JobTask{
+		{Name: "stubborn", AllowFailure: true},
+		{Name: "next", Needs: []string{"stubborn"}},
+	}}
+	UUID, ex := addTestRun(t, l, job,
+		Task{Name: "stubborn", Script: "trap '' TERM; sleep 30", Timeout: 1, Retry: &Retry{MaxAttempts: 2}},
+		Task{Name: "next", Script: "echo next"})
+	start := time.Now()
+	run := executeTestRun(t, l, UUID, ex)
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Timed out task took %s to be killed", elapsed)
+	}
+	if run.Status != "PassedWithWarnings" {
+		t.Errorf("A task timeout should only fail that task, got run %s", run.Status)
+	}
+	if len(run.Results) != 3 {
+		t.Fatalf("Expected 2 attempts and the next task, got %+v", run.Results)
+	}
+	for _, result := range run.Results[:2] {
+		if result.Task.Name != "stubborn" || result.Error != errTimedOut.Error() || result.Signal != "killed" {
+			t.Errorf("Expected the stubborn task to be killed, got %+v", result)
+		}
+	}
+	if next := run.Results[2]; next.Task.Name != "next" || next.Error != "" {
+		t.Errorf("Expected the next task to succeed, got %+v", next)
+	}
+}
+
+func TestParallelTasks(t *testing.T) {
+	l, cleanup := newTestRunList(t)
+	defer cleanup()
+
+	// Run with -race, the results of the parallel tasks are updated while
+	// the run is saved and read
+	job := Job{Name: "job", Tasks: []JobTask{
+		{Name: "first"},
+		{Name: "second"},
+		{Name: "last", Needs: []string{"first", "second"}},
+	}}
+	UUID, ex := addTestRun(t, l, job,
+		Task{Name: "first", Script: "echo first; sleep 0.2"},
+		Task{Name: "second", Script: "echo second > second.txt; sleep 0.2", Artifacts: []string{"second.txt"}},
+		Task{Name: "last", Script: "echo last"})
+	stop := make(chan struct{})
+	read := make(chan struct{})
+	go func() {
+		defer close(read)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if e, err := l.Get(UUID); err == nil {
+				if _, err := json.Marshal(e); err != nil {
+					t.Error(err)
+				}
+			}
+		}
+	}()
+	run := executeTestRun(t, l, UUID, ex)
+	close(stop)
+	<-read
+	if run.Status != "Done" {
+		t.Errorf("Expected run to succeed, got %s", run.Status)
+	}
+	if len(run.Results) != 3 || len(run.Artifacts) != 1 {
+		t.Fatalf("Expected 3 results and an artifact, got %+v %+v", run.Results, run.Artifacts)
+	}
+	for _, result := range run.Results {
+		if result.End.IsZero() || result.Env == nil {
+			t.Errorf("Result of %s was not completed: %+v", result.Task.Name, result)
+		}
+	}
+}
+
+func TestAlwaysRun(t *testing.T) {
+	l, cleanup := newTestRunList(t)
+	defer cleanup()
+
+	tests := []struct {
+		name   string
+		job    Job
+		script string
+		cancel bool
+		status string
+		ran    []string
+	}{
+		{"failure", Job{Name: "job"}, "exit 1", false, "Failed", []string{"first", "cleanup"}},
+		{"allow_failure", Job{Name: "job", Tasks: []JobTask{{Name: "first", AllowFailure: true}, {Name: "next"}, {Name: "cleanup", AlwaysRun: true}}},
+			"exit 1", false, "PassedWithWarnings", []string{"first", "next", "cleanup"}},
+		{"timeout", Job{Name: "job", Timeout: 1}, "sleep 30", false, "TimedOut", []string{"first", "cleanup"}},
+		{"cancel", Job{Name: "job"}, "sleep 30", true, "Cancelled", []string{"first", "cleanup"}},
+	}
+	for _, test := range tests {
+		if len(test.job.Tasks) == 0 {
+			test.job.Tasks = []JobTask{{Name: "first"}, {Name: "next"}, {Name: "cleanup", AlwaysRun: true}}
+		}
+		UUID, ex := addTestRun(t, l, test.job,
+			Task{Name: "first", Script: test.script},
+			Task{Name: "next", Script: "echo next"},
+			Task{Name: "cleanup", Script: "echo cleanup"})
+		if test.cancel {
+			go func() {
+				waitForTask(t, l, UUID)
+				l.Cancel(UUID)
+			}()
+		}
+		run := executeTestRun(t, l, UUID, ex)
+		if run.Status != test.status {
+			t.Errorf("%s: expected run status %s, got %s", test.name, test.status, run.Status)
+		}
+		var ran []string
+		for _, result := range run.Results {
+			ran = append(ran, result.Task.Name)
+		}
+		if strings.Join(ran, ",") != strings.Join(test.ran, ",") {
+			t.Errorf("%s: expected tasks %v to run, got %v", test.name, test.ran, ran)
+		}
+		if last := run.Results[len(run.Results)-1]; last.Task.Name == "cleanup" && last.Error != "" {
+			t.Errorf("%s: cleanup task failed: %s", test.name, last.Error)
+		}
+	}
+}
+
+func TestTaskTimeoutFailsRun(t *testing.T) {
+	l, cleanup := newTestRunList(t)
+	defer cleanup()
+
+	l.jobList.Append(Job{Name: "job", Status: "Ok"})
+	UUID, ex := addTestRun(t, l, Job{Name: "job"},
+		Task{Name: "slow", Script: "sleep 30", Timeout: 1},
+		Task{Name: "next", Script: "echo next"})
+	run := executeTestRun(t, l, UUID, ex)
+	if run.Status != "TimedOut" {
+		t.Errorf("Expected run to time out with its task, got %s", run.Status)
+	}
+	if len(run.Results) != 1 || run.Results[0].Error != errTimedOut.Error() || run.Results[0].Signal != "terminated" {
+		t.Errorf("Only the slow task should have run, and be terminated: %+v", run.Results)
+	}
+	if job, _ := l.jobList.Get("job"); job.(Job).Status != "Failing" {
+		t.Errorf("Expected job to be failing, got %s", job.(Job).Status)
+	}
+}
@@ -2,79 +2,390 @@ package service
 
 import (
 	"fmt"
+	"log"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
 
 	"github.com/nu7hatch/gouuid"
 	cronService "gopkg.in/robfig/cron.v2"
 )
 
-var triggers map[string]struct{}
-
 type Executor struct {
-	cron     *cronService.Cron
-	settings *Settings
-	notifier *Notifier
-	jobList  *JobList
-	taskList *TaskList
-	runList  *RunList
-	entries  map[string]cronService.EntryID
+	cron        *cronService.Cron
+	settings    *Settings
+	notifier    *Notifier
+	jobList     *JobList
+	taskList    *TaskList
+	runList     *RunList
+	triggerList *TriggerList
+	// Cron entries of the armed triggers and the triggers as they were
+	// armed, by trigger name
+	entries     map[string]cronService.EntryID
+	armed       map[string]Trigger
+	entriesLock sync.Mutex
+	// Branch heads seen by the polling triggers
+	pollList *PollList
+	pollLock sync.Mutex
+	// UUIDs of the runs waiting for a worker, oldest first
+	queue     []string
+	queueLock sync.Mutex
+	queueCond *sync.Cond
+	// Persistent workspaces used by a run being executed, only one run at
+	// a time can use each of them
+	busy map[string]bool
+	// Outcome of the last housekeeping pass
+	housekeeping     HousekeepingReport
+	housekeepingLock sync.Mutex
 }
 
-func NewExecutor(settings *Settings, notifier *Notifier, jobList *JobList, taskList *TaskList, runList *RunList) *Executor {
+func NewExecutor(settings *Settings, notifier *Notifier, jobList *JobList, taskList *TaskList, triggerList *TriggerList, runList *RunList, pollList *PollList) *Executor {
 	cron := cronService.New()
 	cron.Start()
-	return &Executor{
-		cron,
-		settings,
-		notifier,
-		jobList,
-		taskList,
-		runList,
-		make(map[string]cronService.EntryID),
+	e := &Executor{
+		cron:        cron,
+		settings:    settings,
+		notifier:    notifier,
+		jobList:     jobList,
+		taskList:    taskList,
+		runList:     runList,
+		triggerList: triggerList,
+		pollList:    pollList,
+		entries:     make(map[string]cronService.EntryID),
+		armed:       make(map[string]Trigger),
+		busy:        make(map[string]bool),
+	}
+	e.queueCond = sync.NewCond(&e.queueLock)
+
+	workers := settings.Executor.MaxConcurrentRuns
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	for i := 0; i < workers; i++ {
+		go e.worker()
+	}
+	go e.housekeepingLoop()
+	e.resume()
+	e.Reconcile()
+	return e
+}
+
+// A cron entry of a trigger.
+type ArmedTrigger struct {
+	Trigger  string    `json:"trigger"`
+	Schedule string    `json:"schedule"`
+	Next     time.Time `json:"next"`
+	// When the trigger last fired, nil if it didn't since it was armed
+	Prev *time.Time `json:"prev,omitempty"`
+}
+
+// Makes the cron entries match the triggers: each trigger attached to a
+// job has exactly one entry, with its current schedule, and the others
+// have none.
+func (e *Executor) Reconcile() {
+	e.entriesLock.Lock()
+	defer e.entriesLock.Unlock()
+
+	wanted := make(map[string]Trigger)
+	for _, t := range e.triggerList.Dump() {
+		trigger := t.(Trigger)
+		if trigger.spec() != "" && len(e.jobList.GetJobsWithTrigger(trigger.Name)) > 0 {
+			wanted[trigger.Name] = trigger
+		}
+	}
+	for name := range e.entries {
+		// The entry of a trigger whose type changed runs the wrong job
+		if trigger, ok := wanted[name]; !ok || trigger.spec() != e.armed[name].spec() || trigger.Type != e.armed[name].Type {
+			e.disarm(name)
+		}
+	}
+	for name, trigger := range wanted {
+		if _, ok := e.entries[name]; !ok {
+			e.arm(trigger)
+		}
 	}
 }
 
-func (e Executor) ArmTrigger(t Trigger) {
-	entryID, err := e.cron.AddFunc(t.Schedule, func() { e.findAndRun(t) })
-	if err == nil {
-		e.entries[t.Name] = entryID
-	} else {
-		fmt.Printf("Error arming trigger %s: %v", t.Name, err)
+func (e *Executor) arm(t Trigger) {
+	name := t.Name
+	schedule, err := ParseSchedule(t.spec())
+	if err != nil {
+		log.Printf("Error arming trigger %s: %v\n", t.Name, err)
+		return
+	}
+	job := func() { e.findAndRun(name, nil) }
+	if t.Type == PollTrigger {
+		job = func() { e.poll(name) }
 	}
+	e.entries[name] = e.cron.Schedule(schedule, cronService.FuncJob(job))
+	e.armed[name] = t
 }
 
-func (e Executor) DisarmTrigger(name string) {
+func (e *Executor) disarm(name string) {
 	e.cron.Remove(e.entries[name])
 	delete(e.entries, name)
-	println("Trigger has been removed")
+	delete(e.armed, name)
+}
+
+// Returns the cron entries of the triggers, by trigger name.
+func (e *Executor) ArmedTriggers() []ArmedTrigger {
+	e.entriesLock.Lock()
+	defer e.entriesLock.Unlock()
+
+	armed := []ArmedTrigger{}
+	for name, id := range e.entries {
+		entry := e.cron.Entry(id)
+		a := ArmedTrigger{Trigger: name, Schedule: e.armed[name].spec(), Next: entry.Next}
+		if !entry.Prev.IsZero() {
+			a.Prev = &entry.Prev
+		}
+		armed = append(armed, a)
+	}
+	sort.Slice(armed, func(i, j int) bool { return armed[i].Trigger < armed[j].Trigger })
+	return armed
 }
 
-// Walks through each job, seeing if the trigger who's turn it is to execute is attached. Executes those jobs.
-func (e Executor) findAndRun(t Trigger) {
-	jobs := e.jobList.GetJobsWithTrigger(t.ID())
+// Runs each job the trigger is attached to, with the parameters the
+// trigger has when it fires, and returns the UUIDs of the new runs. The
+// event that fired the trigger, if any, is recorded on the runs.
+func (e *Executor) findAndRun(name string, event *Event) []string {
+	uuids := []string{}
+	t, err := e.triggerList.Get(name)
+	if err != nil {
+		return uuids
+	}
+	trigger := t.(Trigger)
+	jobs := e.jobList.GetJobsWithTrigger(name)
 	for _, job := range jobs {
 		println("Executing job " + job.Name)
-		e.runnit(job)
+		if id := e.runnit(job, job.declaredParameters(trigger.Parameters), event); id != "" {
+			uuids = append(uuids, id)
+		}
 	}
+	return uuids
 }
 
 // Gathers the tasks attached to the given job and executes them.
-func (e Executor) runnit(j Job) {
-	id, err := uuid.NewV4()
+func (e *Executor) runnit(j Job, parameters map[string]string, event *Event) string {
+	id, err := e.runJob(j, parameters, event)
+	if err != nil {
+		log.Printf("Error running job %s: %v\n", j.Name, err)
+	}
+	return id
+}
+
+// Creates a run for the given job and puts it at the end of the queue.
+// Parameters that are not given take their default value.
+func (e *Executor) RunJob(j Job, parameters map[string]string) (string, error) {
+	return e.runJob(j, parameters, nil)
+}
+
+func (e *Executor) runJob(j Job, parameters map[string]string, event *Event) (string, error) {
+	resolved, err := j.ResolveParameters(parameters)
 	if err != nil {
-		panic(err)
+		return "", err
 	}
 	var tasks []Task
-	for _, taskName := range j.Tasks {
-		task, err2 := e.taskList.Get(taskName)
+	for _, jobTask := range j.Tasks {
+		task, err2 := e.taskList.Get(jobTask.Name)
 		if err2 != nil {
-			panic(err2)
+			return "", err2
 		}
-		t := task.(Task)
-		tasks = append(tasks, t)
+		tasks = append(tasks, task.(Task))
 	}
-	err = e.runList.AddRun(id.String(), filepath.Join(e.settings.Server.OutputPath, "files", "logs"), j, tasks)
+	return e.addRun(j, tasks, resolved, event)
+}
+
+// Adds a run of the given job and tasks to the list and to the queue.
+func (e *Executor) addRun(j Job, tasks []Task, parameters map[string]string, event *Event) (string, error) {
+	id, err := uuid.NewV4()
 	if err != nil {
-		panic(err)
+		return "", err
+	}
+	err = e.runList.AddRun(id.String(), j, tasks, parameters, event)
+	if err != nil {
+		return "", err
+	}
+	e.enqueue(id.String())
+	return id.String(), nil
+}
+
+// Creates a run executing again the tasks of a finished run, with the
+// same parameters, and puts it at the end of the queue.
+func (e *Executor) Rerun(UUID string, fromFailed bool) (string, error) {
+	run, err := e.runList.Get(UUID)
+	if err != nil {
+		return "", err
+	}
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", err
+	}
+	err = e.runList.AddRerun(id.String(), run.(Run), fromFailed)
+	if err != nil {
+		return "", err
+	}
+	e.enqueue(id.String())
+	return id.String(), nil
+}
+
+func (e *Executor) enqueue(UUID string) {
+	e.queueLock.Lock()
+	e.queue = append(e.queue, UUID)
+	e.queueLock.Unlock()
+	e.queueCond.Signal()
+}
+
+// Queues again the runs that were waiting when the server stopped, as
+// well as copies of the interrupted runs of the jobs asking for it.
+func (e *Executor) resume() {
+	for _, run := range e.runList.Queued() {
+		e.enqueue(run.UUID)
+	}
+	for _, run := range e.runList.Interrupted() {
+		if !run.Job.RequeueInterrupted {
+			continue
+		}
+		var id string
+		event, err := eventOf(e.settings, run)
+		if err == nil {
+			id, err = e.addRun(run.Job, run.Tasks, run.Parameters, event)
+		}
+		if err != nil {
+			log.Printf("Error requeuing run %s: %v\n", run.UUID, err)
+			continue
+		}
+		log.Printf("Requeued interrupted run %s as %s\n", run.UUID, id)
+	}
+}
+
+// Picks runs from the queue and executes them, one at a time.
+func (e *Executor) worker() {
+	logRootPath := filepath.Join(e.settings.Server.OutputPath, "files", "logs")
+	for {
+		e.queueLock.Lock()
+		position, workspace := e.next()
+		for position < 0 {
+			e.queueCond.Wait()
+			position, workspace = e.next()
+		}
+		id := e.queue[position]
+		e.queue = append(e.queue[:position], e.queue[position+1:]...)
+		if workspace != "" {
+			e.busy[workspace] = true
+		}
+		ex := e.runList.track(id)
+		e.queueLock.Unlock()
+
+		e.runList.run(id, logRootPath, ex)
+
+		if workspace != "" {
+			e.queueLock.Lock()
+			delete(e.busy, workspace)
+			e.queueLock.Unlock()
+			// The runs waiting for the workspace can be anywhere in the queue
+			e.queueCond.Broadcast()
+		}
+	}
+}
+
+// Returns the position of the oldest queued run that can start, with its
+// persistent workspace if it has one, or -1 when every queued run waits
+// for its workspace. Must be called with queueLock held.
+func (e *Executor) next() (int, string) {
+	for i, id := range e.queue {
+		run, err := e.runList.Get(id)
+		if err != nil {
+			return i, ""
+		}
+		r := run.(Run)
+		if r.Job.Workspace != PersistentWorkspace {
+			return i, ""
+		}
+		if workspace := runWorkspace(e.settings, &r).Dir; !e.busy[workspace] {
+			return i, workspace
+		}
+	}
+	return -1, ""
+}
+
+// Removes expired runs and old workspaces every hour.
+func (e *Executor) housekeepingLoop() {
+	for {
+		report := e.runList.prune(e.settings)
+		e.housekeepingLock.Lock()
+		e.housekeeping = report
+		e.housekeepingLock.Unlock()
+		pruneWorkspaces(e.settings, e.runList)
+		time.Sleep(time.Hour)
+	}
+}
+
+// Returns what the last housekeeping pass removed.
+func (e *Executor) Housekeeping() HousekeepingReport {
+	e.housekeepingLock.Lock()
+	defer e.housekeepingLock.Unlock()
+	return e.housekeeping
+}
+
+// Returns the queued runs, in the order they will be executed.
+func (e *Executor) Queue() []Run {
+	e.queueLock.Lock()
+	defer e.queueLock.Unlock()
+
+	runs := make([]Run, 0, len(e.queue))
+	for i, id := range e.queue {
+		run, err := e.runList.Get(id)
+		if err != nil {
+			continue
+		}
+		r := run.(Run)
+		r.Position = i + 1
+		runs = append(runs, r)
+	}
+	return runs
+}
+
+// Returns the 1-based position of a run in the queue, or 0 when the run
+// is not queued.
+func (e *Executor) QueuePosition(UUID string) int {
+	e.queueLock.Lock()
+	defer e.queueLock.Unlock()
+
+	for i, id := range e.queue {
+		if id == UUID {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Removes a run from the queue before it starts, the run is marked as
+// cancelled.
+func (e *Executor) Dequeue(UUID string) error {
+	e.queueLock.Lock()
+	found := false
+	for i, id := range e.queue {
+		if id == UUID {
+			e.queue = append(e.queue[:i], e.queue[i+1:]...)
+			found = true
+			break
+		}
+	}
+	e.queueLock.Unlock()
+
+	if !found {
+		return fmt.Errorf("Run '%s' is not queued", UUID)
+	}
+	return e.runList.cancelQueued(UUID)
+}
+
+// Cancels a run, whether it is still queued or already running.
+func (e *Executor) Cancel(UUID string) error {
+	if err := e.Dequeue(UUID); err == nil {
+		return nil
 	}
+	return e.runList.Cancel(UUID)
 }
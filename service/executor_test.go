@@ -0,0 +1,99 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+// Creates an executor with the given number of workers, over a test run
+// list.
+func newTestExecutor(t *testing.T, workers int) (*Executor, func()) {
+	runList, cleanup := newTestRunList(t)
+	settings := runList.notifier.settings
+	settings.Executor.MaxConcurrentRuns = workers
+	root := settings.Server.DbRootPath
+	e := NewExecutor(settings, runList.notifier, runList.jobList, NewTaskList(root),
+		NewTriggerList(root), runList, NewPollList(root))
+	return e, cleanup
+}
+
+// Waits until a run reaches one of the given statuses.
+func waitForStatus(t *testing.T, e *Executor, UUID string, statuses ...string) Run {
+	for i := 0; i < 1000; i++ {
+		if r, err := e.runList.Get(UUID); err == nil {
+			for _, status := range statuses {
+				if r.(Run).Status == status {
+					return r.(Run)
+				}
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("Run %s never reached %v", UUID, statuses)
+	return Run{}
+}
+
+func TestWorkerLimit(t *testing.T) {
+	e, cleanup := newTestExecutor(t, 1)
+	defer cleanup()
+	job := Job{Name: "job", Tasks: []JobTask{{Name: "sleep"}}}
+	tasks := []Task{{Name: "sleep", Script: "sleep 0.5"}}
+
+	first, err := e.addRun(job, tasks, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := e.addRun(job, tasks, nil, nil)
+	third, _ := e.addRun(job, tasks, nil, nil)
+	waitForStatus(t, e, first, "Running")
+
+	// The only worker is busy, the other runs wait in order
+	if e.QueuePosition(second) != 1 || e.QueuePosition(third) != 2 || e.QueuePosition(first) != 0 {
+		t.Errorf("Unexpected queue %v", e.Queue())
+	}
+	if err := e.Dequeue(second); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Dequeue(second); err == nil {
+		t.Error("Run removed from the queue should not be dequeued again")
+	}
+	if e.QueuePosition(third) != 1 {
+		t.Errorf("Expected the third run to move up, got %v", e.Queue())
+	}
+
+	r1 := waitForStatus(t, e, first, "Done")
+	r3 := waitForStatus(t, e, third, "Done")
+	if r3.Start.Before(r1.End) {
+		t.Errorf("Runs overlapped with a single worker: %s < %s", r3.Start, r1.End)
+	}
+	if r2 := waitForStatus(t, e, second, "Cancelled"); len(r2.Results) != 0 {
+		t.Errorf("Dequeued run should not have started: %v", r2.Results)
+	}
+}
+
+func TestPersistentWorkspaceRuns(t *testing.T) {
+	e, cleanup := newTestExecutor(t, 3)
+	defer cleanup()
+	job := Job{Name: "job", Workspace: PersistentWorkspace, Tasks: []JobTask{{Name: "sleep"}}}
+	other := Job{Name: "other", Workspace: PersistentWorkspace, Tasks: []JobTask{{Name: "sleep"}}}
+	tasks := []Task{{Name: "sleep", Script: "sleep 0.5"}}
+
+	first, _ := e.addRun(job, tasks, nil, nil)
+	second, _ := e.addRun(job, tasks, nil, nil)
+	third, _ := e.addRun(other, tasks, nil, nil)
+	r1 := waitForStatus(t, e, first, "Done")
+	r2 := waitForStatus(t, e, second, "Done")
+	r3 := waitForStatus(t, e, third, "Done")
+
+	// Runs of the same job share the workspace and wait for each other,
+	// the other job has a workspace of its own
+	if r2.Start.Before(r1.End) {
+		t.Errorf("Runs sharing a workspace overlapped: %s < %s", r2.Start, r1.End)
+	}
+	if r3.Start.After(r1.End) {
+		t.Errorf("Run of another job waited: %s > %s", r3.Start, r1.End)
+	}
+	if r1.Workspace != r2.Workspace || r1.Workspace == r3.Workspace {
+		t.Errorf("Unexpected workspaces %s, %s and %s", r1.Workspace, r2.Workspace, r3.Workspace)
+	}
+}
@@ -3,6 +3,7 @@ package service
 import (
 	"encoding/json"
 	"fmt"
+	"path/filepath"
 	"sort"
 
 	"github.com/gorilla/websocket"
@@ -13,16 +14,26 @@ type Hub struct {
 	register    chan *Connection
 	unregister  chan *Connection
 	refresh     chan bool
+	subscribe   chan subscription
 	runList     *RunList
+	executor    *Executor
+	// Next offset to send of the logs of each run, for each subscriber
+	subscriptions map[string]map[*Connection]map[string]int
+	// Lines already sent of the logs being written, by run and log name
+	streamed map[string]map[string]int
 }
 
-func NewHub(runList *RunList) *Hub {
+func NewHub(runList *RunList, executor *Executor) *Hub {
 	return &Hub{
-		refresh:     make(chan bool),
-		register:    make(chan *Connection),
-		unregister:  make(chan *Connection),
-		connections: make(map[*Connection]bool),
-		runList:     runList,
+		refresh:       make(chan bool),
+		register:      make(chan *Connection),
+		unregister:    make(chan *Connection),
+		subscribe:     make(chan subscription),
+		connections:   make(map[*Connection]bool),
+		runList:       runList,
+		executor:      executor,
+		subscriptions: make(map[string]map[*Connection]map[string]int),
+		streamed:      make(map[string]map[string]int),
 	}
 }
 
@@ -38,10 +49,16 @@ func (h *Hub) Refresh() {
 	h.refresh <- true
 }
 
+// Message sent over the websocket with the most recent runs.
+type RunsMessage struct {
+	Type string      `json:"type"`
+	Runs []elementer `json:"runs"`
+}
+
 func (h *Hub) onRefresh() []byte {
 	sort.Sort(Reverse{h.runList})
 	recent := h.runList.GetRecent(0, 10)
-	bytes, err := json.Marshal(recent)
+	bytes, err := json.Marshal(RunsMessage{Type: "runs", Runs: recent})
 	if err != nil {
 		panic(err.Error())
 	}
@@ -58,24 +75,127 @@ func (h *Hub) HubLoop() {
 			c.send <- bytes
 		case c := <-h.unregister:
 			fmt.Println("Disconnect")
-			delete(h.connections, c)
-			close(c.send)
+			if h.connections[c] {
+				h.drop(c)
+			}
 		case <-h.refresh:
 			fmt.Println("Refreshing")
 			bytes := h.onRefresh()
 			for c := range h.connections {
-				select {
-				case c.send <- bytes:
-				default:
-					delete(h.connections, c)
-					close(c.send)
-					go c.ws.Close()
-				}
+				h.send(c, bytes)
 			}
+		case s := <-h.subscribe:
+			h.onSubscribe(s)
+		case e := <-h.runList.logs:
+			h.onLog(e)
+		}
+	}
+}
+
+// Sends a message to a client, dropping it when it can't keep up.
+func (h *Hub) send(c *Connection, bytes []byte) {
+	select {
+	case c.send <- bytes:
+	default:
+		h.drop(c)
+		go c.ws.Close()
+	}
+}
+
+func (h *Hub) drop(c *Connection) {
+	delete(h.connections, c)
+	for run, subscribers := range h.subscriptions {
+		delete(subscribers, c)
+		if len(subscribers) == 0 {
+			delete(h.subscriptions, run)
+		}
+	}
+	close(c.send)
+}
+
+// A client starting or stopping to follow the logs of a run.
+type subscription struct {
+	conn *Connection
+	cmd  command
+}
+
+// Sends the lines of the run logs the client doesn't have yet, the
+// following ones are sent as they are written.
+func (h *Hub) onSubscribe(s subscription) {
+	if !h.connections[s.conn] {
+		return
+	}
+	if s.cmd.Command == "unsubscribe" {
+		if subscribers := h.subscriptions[s.cmd.Run]; subscribers != nil {
+			delete(subscribers, s.conn)
+		}
+		return
+	}
+	run, err := h.runList.Get(s.cmd.Run)
+	if err != nil {
+		fmt.Printf("Error subscribing to run: %s\n", err.Error())
+		return
+	}
+	offsets := make(map[string]int)
+	for name, offset := range s.cmd.Offsets {
+		offsets[name] = offset
+	}
+	for _, result := range run.(Run).Results {
+		name := result.LogFileName
+		// Lines of the logs being written are read up to the ones already
+		// streamed, the others are sent once their event comes, and any
+		// line read twice is skipped by onLog thanks to the offsets
+		limit, streaming := h.streamed[s.cmd.Run][name]
+		if !streaming {
+			limit = -1
+		}
+		lines, err := readLogLines(filepath.Join(result.LogPath, name), offsets[name], limit)
+		if err != nil {
+			continue
+		}
+		if len(lines) > 0 {
+			h.sendLog(s.conn, LogMessage{Type: "log", Run: s.cmd.Run, Log: name, Offset: offsets[name], Lines: lines})
+		}
+		offsets[name] += len(lines)
+	}
+	if h.subscriptions[s.cmd.Run] == nil {
+		h.subscriptions[s.cmd.Run] = make(map[*Connection]map[string]int)
+	}
+	h.subscriptions[s.cmd.Run][s.conn] = offsets
+}
+
+// Forwards the lines written to a log to the clients following the run.
+func (h *Hub) onLog(e logEvent) {
+	if h.streamed[e.Run] == nil {
+		h.streamed[e.Run] = make(map[string]int)
+	}
+	h.streamed[e.Run][e.Log] = e.Offset + len(e.Lines)
+	if e.Closed {
+		delete(h.streamed[e.Run], e.Log)
+		if len(h.streamed[e.Run]) == 0 {
+			delete(h.streamed, e.Run)
+		}
+	}
+	if len(e.Lines) == 0 {
+		return
+	}
+	for c, offsets := range h.subscriptions[e.Run] {
+		if e.Offset < offsets[e.Log] {
+			continue
 		}
+		offsets[e.Log] = e.Offset + len(e.Lines)
+		h.sendLog(c, LogMessage{Type: "log", Run: e.Run, Log: e.Log, Offset: e.Offset, Lines: e.Lines})
 	}
 }
 
+func (h *Hub) sendLog(c *Connection, message LogMessage) {
+	bytes, err := json.Marshal(message)
+	if err != nil {
+		panic(err.Error())
+	}
+	h.send(c, bytes)
+}
+
 type Connection struct {
 	ws   *websocket.Conn
 	send chan []byte
@@ -85,7 +205,36 @@ func NewConnection(ws *websocket.Conn) *Connection {
 	return &Connection{send: make(chan []byte, 256), ws: ws}
 }
 
-func (c *Connection) Reader() {
+// A command sent by a client over the websocket.
+type command struct {
+	Command string `json:"command"`
+	Run     string `json:"run"`
+	// Number of lines the client already has of each log of the run,
+	// when subscribing
+	Offsets map[string]int `json:"offsets,omitempty"`
+}
+
+func (h *Hub) onCommand(c *Connection, msg []byte) {
+	var cmd command
+	if err := json.Unmarshal(msg, &cmd); err != nil {
+		fmt.Printf("Invalid websocket command: %s\n", err.Error())
+		return
+	}
+	switch cmd.Command {
+	case "cancel":
+		if err := h.executor.Cancel(cmd.Run); err != nil {
+			fmt.Printf("Error cancelling run: %s\n", err.Error())
+			return
+		}
+		h.Refresh()
+	case "subscribe", "unsubscribe":
+		h.subscribe <- subscription{c, cmd}
+	default:
+		fmt.Printf("Unknown websocket command: %s\n", cmd.Command)
+	}
+}
+
+func (c *Connection) Reader(h *Hub) {
 	for {
 		_, msg, err := c.ws.ReadMessage()
 		if err != nil {
@@ -93,7 +242,7 @@ func (c *Connection) Reader() {
 			break
 		}
 		fmt.Printf("Message received: %s\n", msg)
-		// TODO: Do something with the msg
+		h.onCommand(c, msg)
 	}
 	c.ws.Close()
 }
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestHubLogStreaming(t *testing.T) {
+	root, err := ioutil.TempDir("", "hub")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	ioutil.WriteFile(filepath.Join(root, "t.log"), []byte("a\nb\nc\n"), 0644)
+
+	runList := NewRunList(root, nil, nil, nil)
+	runList.Append(Run{UUID: "uuid", Results: []*Result{{LogPath: root, LogFileName: "t.log"}}})
+	h := NewHub(runList, nil)
+	c := &Connection{send: make(chan []byte, 10)}
+	h.connections[c] = true
+
+	// The third line is written but its event is still queued
+	h.onLog(logEvent{Run: "uuid", Log: "t.log"})
+	h.onLog(logEvent{Run: "uuid", Log: "t.log", Offset: 0, Lines: []LogLine{{Line: "a"}}})
+	h.onLog(logEvent{Run: "uuid", Log: "t.log", Offset: 1, Lines: []LogLine{{Line: "b"}}})
+	h.onSubscribe(subscription{c, command{Command: "subscribe", Run: "uuid", Offsets: map[string]int{"t.log": 1}}})
+	h.onLog(logEvent{Run: "uuid", Log: "t.log", Offset: 2, Lines: []LogLine{{Line: "c"}}})
+	h.onLog(logEvent{Run: "uuid", Log: "t.log", Offset: 3, Closed: true})
+
+	var lines []string
+	for len(c.send) > 0 {
+		var message LogMessage
+		json.Unmarshal(<-c.send, &message)
+		if message.Offset != len(lines)+1 {
+			t.Errorf("Unexpected offset %d after %v", message.Offset, lines)
+		}
+		for _, line := range message.Lines {
+			lines = append(lines, line.Line)
+		}
+	}
+	if len(lines) != 2 || lines[0] != "b" || lines[1] != "c" {
+		t.Errorf("Expected lines b and c, got %v", lines)
+	}
+	if len(h.streamed) != 0 {
+		t.Errorf("Closed log still streamed")
+	}
+}
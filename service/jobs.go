@@ -3,27 +3,86 @@ package service
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"path/filepath"
 )
 
+// A task referenced by a job.
+type JobTask struct {
+	Name string `json:"name"`
+	// Names of the tasks of the same job that must succeed before this one
+	Needs []string `json:"needs,omitempty"`
+	// A failure of the task is reported as a warning and does not fail the job
+	AllowFailure bool `json:"allow_failure,omitempty"`
+	// The task runs once the tasks it needs are over, even if some failed
+	AlwaysRun bool `json:"always_run,omitempty"`
+}
+
+// Accepts the plain task names used before dependencies were introduced.
+func (t *JobTask) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*t = JobTask{Name: name}
+		return nil
+	}
+	type jobTask JobTask
+	return json.Unmarshal(data, (*jobTask)(t))
+}
+
 type Job struct {
-	Name     string   `json:"name"`
-	Tasks    []string `json:"tasks"`
-	Status   string   `json:"status"`
-	Triggers []string `json:"triggers"`
+	Name     string    `json:"name"`
+	Tasks    []JobTask `json:"tasks"`
+	Status   string    `json:"status"`
+	Triggers []string  `json:"triggers"`
+	// Seconds after which the whole run is terminated, no limit when 0
+	Timeout    int         `json:"timeout,omitempty"`
+	Parameters []Parameter `json:"parameters,omitempty"`
+	// Variables set for every task of the job
+	Env map[string]string `json:"env,omitempty"`
+	// Names of the secrets given to the tasks, as variables of the same name
+	Secrets []string `json:"secrets,omitempty"`
+	// FreshWorkspace, the default, or PersistentWorkspace
+	Workspace string `json:"workspace,omitempty"`
+	// Queue the runs interrupted by a server restart again once it is back
+	RequeueInterrupted bool `json:"requeue_interrupted,omitempty"`
 }
 
 func (j Job) ID() string {
 	return j.Name
 }
 
+// Returns a copy of the tasks, so that a job got from the list can be
+// changed without changing the stored one.
+func (j *Job) copyTasks() []JobTask {
+	return append(make([]JobTask, 0, len(j.Tasks)+1), j.Tasks...)
+}
+
 func (j *Job) AppendTask(task string) {
-	j.Tasks = append(j.Tasks, task)
+	j.Tasks = append(j.copyTasks(), JobTask{Name: task})
+}
+
+func (j *Job) GetTask(taskPosition int) (JobTask, error) {
+	if taskPosition < 0 || taskPosition >= len(j.Tasks) {
+		return JobTask{}, fmt.Errorf("No task at position %d", taskPosition)
+	}
+	return j.Tasks[taskPosition], nil
+}
+
+func (j *Job) SetTask(taskPosition int, task JobTask) error {
+	if taskPosition < 0 || taskPosition >= len(j.Tasks) {
+		return fmt.Errorf("No task at position %d", taskPosition)
+	}
+	j.Tasks = j.copyTasks()
+	j.Tasks[taskPosition] = task
+	return nil
 }
 
 func (j *Job) DeleteTask(taskPosition int) error {
-	i := taskPosition
-	j.Tasks = j.Tasks[:i+copy(j.Tasks[i:], j.Tasks[i+1:])]
+	if taskPosition < 0 || taskPosition >= len(j.Tasks) {
+		return fmt.Errorf("No task at position %d", taskPosition)
+	}
+	tasks := j.copyTasks()
+	j.Tasks = append(tasks[:taskPosition], tasks[taskPosition+1:]...)
 	return nil
 }
 
@@ -47,6 +106,109 @@ func (j *Job) DeleteTrigger(trigger string) error {
 	return errors.New("Trigger not found")
 }
 
+// Tells whether the tasks declare dependencies, otherwise they are executed
+// one after the other in the order they were added.
+func (j Job) isGraph() bool {
+	for _, task := range j.Tasks {
+		if len(task.Needs) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns for each task the positions of the tasks it needs.
+func (j Job) dependencies() ([][]int, error) {
+	deps := make([][]int, len(j.Tasks))
+	if !j.isGraph() {
+		for i := 1; i < len(j.Tasks); i++ {
+			deps[i] = []int{i - 1}
+		}
+		return deps, nil
+	}
+
+	positions := make(map[string]int)
+	for i, task := range j.Tasks {
+		if _, found := positions[task.Name]; found {
+			return nil, fmt.Errorf("Task '%s' is used more than once", task.Name)
+		}
+		positions[task.Name] = i
+	}
+	for i, task := range j.Tasks {
+		for _, name := range task.Needs {
+			position, found := positions[name]
+			if !found {
+				return nil, fmt.Errorf("Task '%s' needs '%s' which is not part of the job", task.Name, name)
+			}
+			if position == i {
+				return nil, fmt.Errorf("Task '%s' needs itself", task.Name)
+			}
+			deps[i] = append(deps[i], position)
+		}
+	}
+
+	// Kahn's algorithm, tasks left unsorted are part of a cycle
+	pending := make([]int, len(j.Tasks))
+	dependents := make([][]int, len(j.Tasks))
+	var ready []int
+	for i := range deps {
+		pending[i] = len(deps[i])
+		for _, dep := range deps[i] {
+			dependents[dep] = append(dependents[dep], i)
+		}
+		if pending[i] == 0 {
+			ready = append(ready, i)
+		}
+	}
+	sorted := 0
+	for len(ready) > 0 {
+		i := ready[0]
+		ready = ready[1:]
+		sorted++
+		for _, dependent := range dependents[i] {
+			pending[dependent]--
+			if pending[dependent] == 0 {
+				ready = append(ready, dependent)
+			}
+		}
+	}
+	if sorted != len(j.Tasks) {
+		for i, task := range j.Tasks {
+			if pending[i] > 0 {
+				return nil, fmt.Errorf("Task '%s' is part of a dependency cycle", task.Name)
+			}
+		}
+	}
+	return deps, nil
+}
+
+// Checks that every task exists, that the dependencies form a graph that
+// can be executed and that the variables and parameters are well defined.
+func (j Job) Validate(taskList *TaskList) error {
+	for _, task := range j.Tasks {
+		if _, err := taskList.Get(task.Name); err != nil {
+			return err
+		}
+	}
+	if _, err := j.dependencies(); err != nil {
+		return err
+	}
+	if err := ValidateEnv(j.Env); err != nil {
+		return err
+	}
+	for _, name := range j.Secrets {
+		if !identifier.MatchString(name) {
+			return fmt.Errorf("Invalid secret name '%s'", name)
+		}
+	}
+	switch j.Workspace {
+	case "", FreshWorkspace, PersistentWorkspace:
+	default:
+		return fmt.Errorf("Unknown workspace kind '%s'", j.Workspace)
+	}
+	return j.validateParameters()
+}
+
 type JobList struct {
 	list
 }
@@ -88,7 +250,7 @@ func (l *JobList) GetJobsWithTask(taskName string) (jobs []Job) {
 	for _, e := range l.elements {
 		job := e.(Job)
 		for _, task := range job.Tasks {
-			if task == taskName {
+			if task.Name == taskName {
 				jobs = append(jobs, job)
 			}
 		}
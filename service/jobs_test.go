@@ -1,6 +1,7 @@
 package service
 
 import (
+	"encoding/json"
 	"fmt"
 	"testing"
 )
@@ -13,9 +14,57 @@ func TestJobID(t *testing.T) {
 }
 
 func TestJobAppendTask(t *testing.T) {
-	job := Job{"name", make([]string, 0), "status", make([]string, 0)}
+	job := Job{Name: "name", Tasks: make([]JobTask, 0), Status: "status", Triggers: make([]string, 0)}
 	job.AppendTask("task")
-	expected := []string{"task"}
+	expected := []JobTask{{Name: "task"}}
+	if fmt.Sprintf("%#v", job.Tasks) != fmt.Sprintf("%#v", expected) {
+		t.Errorf("Expected %#v but got %#v", expected, job.Tasks)
+	}
+}
+
+func TestJobDependencies(t *testing.T) {
+	job := Job{Name: "name", Tasks: []JobTask{{Name: "a"}, {Name: "b"}, {Name: "c"}}}
+	deps, err := job.dependencies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]int{nil, {0}, {1}}
+	if fmt.Sprintf("%v", deps) != fmt.Sprintf("%v", expected) {
+		t.Errorf("Expected %v but got %v", expected, deps)
+	}
+
+	job.Tasks = []JobTask{{Name: "lint"}, {Name: "test"}, {Name: "deploy", Needs: []string{"lint", "test"}}}
+	deps, err = job.dependencies()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = [][]int{nil, nil, {0, 1}}
+	if fmt.Sprintf("%v", deps) != fmt.Sprintf("%v", expected) {
+		t.Errorf("Expected %v but got %v", expected, deps)
+	}
+}
+
+func TestJobInvalidDependencies(t *testing.T) {
+	jobs := []Job{
+		{Name: "cycle", Tasks: []JobTask{{Name: "a", Needs: []string{"b"}}, {Name: "b", Needs: []string{"a"}}}},
+		{Name: "self", Tasks: []JobTask{{Name: "a", Needs: []string{"a"}}}},
+		{Name: "unknown", Tasks: []JobTask{{Name: "a", Needs: []string{"b"}}}},
+		{Name: "duplicate", Tasks: []JobTask{{Name: "a"}, {Name: "a"}, {Name: "b", Needs: []string{"a"}}}},
+	}
+	for _, job := range jobs {
+		if _, err := job.dependencies(); err == nil {
+			t.Errorf("Expected job '%s' to be rejected", job.Name)
+		}
+	}
+}
+
+func TestJobTaskUnmarshal(t *testing.T) {
+	var job Job
+	err := json.Unmarshal([]byte(`{"name": "job", "tasks": ["a", {"name": "b", "needs": ["a"]}]}`), &job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []JobTask{{Name: "a"}, {Name: "b", Needs: []string{"a"}}}
 	if fmt.Sprintf("%#v", job.Tasks) != fmt.Sprintf("%#v", expected) {
 		t.Errorf("Expected %#v but got %#v", expected, job.Tasks)
 	}
@@ -81,6 +81,21 @@ func (l *list) Delete(id string) error {
 	return nil
 }
 
+// Deletes the elements with the given ids, saving the list once.
+func (l *list) deleteAll(ids map[string]bool) {
+	l.Lock()
+	defer l.Unlock()
+
+	kept := make([]elementer, 0, len(l.elements))
+	for _, e := range l.elements {
+		if !ids[e.ID()] {
+			kept = append(kept, e)
+		}
+	}
+	l.elements = kept
+	l.save()
+}
+
 func (l *list) save() {
 	writeFile(l.dumps(), l.fileName)
 }
@@ -93,10 +108,13 @@ func (l *list) dumps() []byte {
 	return bytes
 }
 
+// Returns a copy of the elements, which Update can then change safely.
 func (l *list) Dump() []elementer {
 	l.RLock()
 	defer l.RUnlock()
-	return l.elements
+	elements := make([]elementer, len(l.elements))
+	copy(elements, l.elements)
+	return elements
 }
 
 func (l *list) pos(id string) (int, error) {
@@ -0,0 +1,350 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// Maximum number of hits returned by a search
+	maxSearchHits = 100
+	// Maximum length of the snippets of the hits
+	snippetLength = 200
+)
+
+// Words of the task logs, appended to logIndexFile as one JSON object per
+// indexed log so that finishing a task doesn't rewrite the whole index.
+type LogIndex struct {
+	sync.RWMutex
+	fileName string
+	// Logs containing each word, logs are identified by run and log name
+	terms map[string]map[logDocument]bool
+	// Words of each log
+	docs map[logDocument][]string
+}
+
+type logDocument struct {
+	Run string `json:"run"`
+	Log string `json:"log"`
+}
+
+type logIndexEntry struct {
+	logDocument
+	Terms []string `json:"terms"`
+}
+
+// A line matching a search.
+type LogHit struct {
+	Run  string `json:"run"`
+	Job  string `json:"job"`
+	Task string `json:"task"`
+	Log  string `json:"log"`
+	// Starts from 1
+	Line    int    `json:"line"`
+	Snippet string `json:"snippet"`
+}
+
+func NewLogIndex(rootPath string) *LogIndex {
+	return &LogIndex{
+		fileName: filepath.Join(rootPath, logIndexFile),
+		terms:    make(map[string]map[logDocument]bool),
+		docs:     make(map[logDocument][]string),
+	}
+}
+
+func (x *LogIndex) Load() {
+	x.Lock()
+	defer x.Unlock()
+	file, err := os.Open(x.fileName)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("Cannot read log index:", err)
+		}
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		var entry logIndexEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			log.Println("Skipping invalid log index entry:", err)
+			continue
+		}
+		x.insert(entry)
+	}
+}
+
+func (x *LogIndex) insert(entry logIndexEntry) {
+	x.docs[entry.logDocument] = entry.Terms
+	for _, term := range entry.Terms {
+		if x.terms[term] == nil {
+			x.terms[term] = make(map[logDocument]bool)
+		}
+		x.terms[term][entry.logDocument] = true
+	}
+}
+
+func (x *LogIndex) indexed(run, logFileName string) bool {
+	x.RLock()
+	defer x.RUnlock()
+	_, ok := x.docs[logDocument{run, logFileName}]
+	return ok
+}
+
+// Adds the words of the log of a finished result to the index.
+func (x *LogIndex) add(run string, result *Result) error {
+	lines, err := readLogLines(filepath.Join(result.LogPath, result.LogFileName), 0, -1)
+	if err != nil {
+		return err
+	}
+	words := make(map[string]bool)
+	for _, line := range lines {
+		for _, term := range terms(line.Line) {
+			words[term] = true
+		}
+	}
+	entry := logIndexEntry{logDocument: logDocument{run, result.LogFileName}}
+	for term := range words {
+		entry.Terms = append(entry.Terms, term)
+	}
+	sort.Strings(entry.Terms)
+	bytes, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	x.Lock()
+	defer x.Unlock()
+	if _, ok := x.docs[entry.logDocument]; ok {
+		return nil
+	}
+	file, err := os.OpenFile(x.fileName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(append(bytes, '\n')); err != nil {
+		return err
+	}
+	x.insert(entry)
+	return nil
+}
+
+// Removes the logs of runs from the index.
+func (x *LogIndex) Remove(runs ...string) error {
+	x.Lock()
+	defer x.Unlock()
+	removing := make(map[string]bool)
+	for _, run := range runs {
+		removing[run] = true
+	}
+	removed := false
+	for doc, words := range x.docs {
+		if !removing[doc.Run] {
+			continue
+		}
+		for _, term := range words {
+			delete(x.terms[term], doc)
+			if len(x.terms[term]) == 0 {
+				delete(x.terms, term)
+			}
+		}
+		delete(x.docs, doc)
+		removed = true
+	}
+	if !removed {
+		return nil
+	}
+
+	// Rewrite the index without the runs
+	file, err := os.Create(x.fileName + ".tmp")
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(file)
+	for doc, words := range x.docs {
+		bytes, err := json.Marshal(logIndexEntry{doc, words})
+		if err != nil {
+			file.Close()
+			return err
+		}
+		writer.Write(append(bytes, '\n'))
+	}
+	if err := writer.Flush(); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return err
+	}
+	return os.Rename(x.fileName+".tmp", x.fileName)
+}
+
+// Returns the logs that can contain the query, every log when it has no
+// words. The first and the last words of the query can be parts of words
+// of the log, the other ones are whole words.
+func (x *LogIndex) candidates(query string) []logDocument {
+	x.RLock()
+	defer x.RUnlock()
+	var docs []logDocument
+	words := terms(query)
+	if len(words) == 0 {
+		for doc := range x.docs {
+			docs = append(docs, doc)
+		}
+		return docs
+	}
+
+	lower := strings.ToLower(query)
+	prefix := strings.HasPrefix(lower, words[0])
+	suffix := strings.HasSuffix(lower, words[len(words)-1])
+	matches := make([]map[logDocument]bool, len(words))
+	for i, word := range words {
+		first, last := i == 0 && prefix, i == len(words)-1 && suffix
+		if !first && !last {
+			matches[i] = x.terms[word]
+			continue
+		}
+		matches[i] = make(map[logDocument]bool)
+		for term, termDocs := range x.terms {
+			if (first && last && strings.Contains(term, word)) ||
+				(first && !last && strings.HasSuffix(term, word)) ||
+				(!first && last && strings.HasPrefix(term, word)) {
+				for doc := range termDocs {
+					matches[i][doc] = true
+				}
+			}
+		}
+	}
+	for doc := range matches[0] {
+		found := true
+		for _, m := range matches[1:] {
+			if !m[doc] {
+				found = false
+				break
+			}
+		}
+		if found {
+			docs = append(docs, doc)
+		}
+	}
+	return docs
+}
+
+// Splits a text into lower case words.
+func terms(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+	})
+}
+
+// Indexes the logs of the finished tasks that are not indexed yet, such
+// as the ones written before the index existed.
+func (l *RunList) indexLogs() {
+	for _, e := range l.Dump() {
+		run := e.(Run)
+		for _, result := range run.Results {
+			if result.End.IsZero() || l.index.indexed(run.UUID, result.LogFileName) {
+				continue
+			}
+			if err := l.index.add(run.UUID, result); err != nil && !os.IsNotExist(err) {
+				log.Println("Cannot index log:", err)
+			}
+		}
+	}
+}
+
+// Returns the log lines containing the query, ignoring case, from the
+// most recent runs. Only the runs of the given job are searched unless it
+// is empty, and only the ones started after since unless it is zero.
+func (l *RunList) SearchLogs(query, job string, since time.Time) ([]LogHit, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, errors.New("Please provide a query")
+	}
+	type candidate struct {
+		run    Run
+		result *Result
+	}
+	var candidates []candidate
+	for _, doc := range l.index.candidates(query) {
+		e, err := l.Get(doc.Run)
+		if err != nil {
+			continue
+		}
+		run := e.(Run)
+		if (job != "" && run.Job.Name != job) || (!since.IsZero() && run.Start.Before(since)) {
+			continue
+		}
+		if result, ok := run.Result(doc.Log); ok {
+			candidates = append(candidates, candidate{run, result})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if !candidates[i].run.Start.Equal(candidates[j].run.Start) {
+			return candidates[i].run.Start.After(candidates[j].run.Start)
+		}
+		return candidates[i].result.Start.Before(candidates[j].result.Start)
+	})
+
+	hits := []LogHit{}
+	needle := strings.ToLower(query)
+	for _, c := range candidates {
+		lines, err := readLogLines(filepath.Join(c.result.LogPath, c.result.LogFileName), 0, -1)
+		if err != nil {
+			continue
+		}
+		for i, line := range lines {
+			pos := strings.Index(strings.ToLower(line.Line), needle)
+			if pos < 0 {
+				continue
+			}
+			hits = append(hits, LogHit{
+				Run:     c.run.UUID,
+				Job:     c.run.Job.Name,
+				Task:    c.result.Task.Name,
+				Log:     c.result.LogFileName,
+				Line:    i + 1,
+				Snippet: snippet(line.Line, pos, len(needle)),
+			})
+			if len(hits) == maxSearchHits {
+				return hits, nil
+			}
+		}
+	}
+	return hits, nil
+}
+
+// Returns the part of a line around a match.
+func snippet(line string, pos, length int) string {
+	if len(line) <= snippetLength {
+		return line
+	}
+	start := pos - (snippetLength-length)/2
+	if start < 0 {
+		start = 0
+	}
+	end := start + snippetLength
+	if end > len(line) {
+		end = len(line)
+		start = end - snippetLength
+	}
+	// Don't cut multi-byte characters
+	for start > 0 && !utf8.RuneStart(line[start]) {
+		start--
+	}
+	for end < len(line) && !utf8.RuneStart(line[end]) {
+		end++
+	}
+	return line[start:end]
+}
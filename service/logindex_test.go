@@ -0,0 +1,54 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSearchLogs(t *testing.T) {
+	root, err := ioutil.TempDir("", "search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	ioutil.WriteFile(filepath.Join(root, "build.log"), []byte("compiling\nmain.c:3: undefined reference to 'foo'\n"), 0644)
+	ioutil.WriteFile(filepath.Join(root, "test.log"), []byte("running tests\nok\n"), 0644)
+
+	runList := NewRunList(root, nil, nil, nil)
+	start := time.Date(2016, 1, 1, 10, 0, 0, 0, time.UTC)
+	for i, name := range []string{"build", "test"} {
+		result := &Result{Task: Task{Name: name}, LogPath: root, LogFileName: name + ".log", End: start}
+		run := Run{UUID: name, Job: Job{Name: name}, Start: start.AddDate(0, 0, i), Results: []*Result{result}}
+		runList.Append(run)
+		if err := runList.index.add(run.UUID, result); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	hits, err := runList.SearchLogs("ned Reference to", "", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hits) != 1 || hits[0].Run != "build" || hits[0].Task != "build" || hits[0].Line != 2 {
+		t.Errorf("Unexpected hits %v", hits)
+	}
+	if hits, _ := runList.SearchLogs("compiling", "test", time.Time{}); len(hits) != 0 {
+		t.Errorf("Hits of another job %v", hits)
+	}
+	if hits, _ := runList.SearchLogs("in", "", start.AddDate(0, 0, 1)); len(hits) != 1 || hits[0].Run != "test" {
+		t.Errorf("Expected only the recent run, got %v", hits)
+	}
+
+	// The index is reloaded from the disk without the removed run
+	if err := runList.index.Remove("build"); err != nil {
+		t.Fatal(err)
+	}
+	index := NewLogIndex(root)
+	index.Load()
+	if len(index.docs) != 1 || !index.indexed("test", "test.log") {
+		t.Errorf("Unexpected index %v", index.docs)
+	}
+}
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Streams of the output of a task.
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+)
+
+// Extension of the structured logs, older logs are plain text.
+const logExtension = ".jsonl"
+
+// A line printed by a task, logs are stored with one per line as JSON.
+type LogLine struct {
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"`
+	Line   string    `json:"line"`
+}
+
+// A log line as returned by the API.
+type LogEntry struct {
+	LogLine
+	// Position of the line in the log
+	Offset int `json:"offset"`
+	// Seconds since the task started
+	Elapsed float64 `json:"elapsed"`
+	// Seconds since the previous line, of any stream
+	Delta float64 `json:"delta"`
+}
+
+// Lines written to the log of a task, sent to the Hub so that it can
+// stream them to the subscribed clients. The first event of a log has
+// no lines and announces it.
+type logEvent struct {
+	Run string
+	Log string
+	// Position of the first line in the log
+	Offset int
+	Lines  []LogLine
+	// Set once the log is complete
+	Closed bool
+}
+
+// Message sent over the websocket with lines of a log.
+type LogMessage struct {
+	Type   string    `json:"type"`
+	Run    string    `json:"run"`
+	Log    string    `json:"log"`
+	Offset int       `json:"offset"`
+	Lines  []LogLine `json:"lines"`
+}
+
+// Writes the lines of a task log and streams them.
+type logWriter struct {
+	file   *os.File
+	run    string
+	log    string
+	offset int
+	events chan<- logEvent
+}
+
+func newLogWriter(result *Result, run string, events chan<- logEvent) (*logWriter, error) {
+	file, err := os.Create(filepath.Join(result.LogPath, result.LogFileName))
+	if err != nil {
+		return nil, err
+	}
+	events <- logEvent{Run: run, Log: result.LogFileName}
+	return &logWriter{file: file, run: run, log: result.LogFileName, events: events}, nil
+}
+
+func (w *logWriter) writeLine(stream, line string) {
+	l := LogLine{Time: time.Now(), Stream: stream, Line: line}
+	bytes, err := json.Marshal(l)
+	if err != nil {
+		panic(err)
+	}
+	w.file.Write(append(bytes, '\n'))
+	w.events <- logEvent{Run: w.run, Log: w.log, Offset: w.offset, Lines: []LogLine{l}}
+	w.offset++
+}
+
+func (w *logWriter) close() {
+	w.file.Close()
+	w.events <- logEvent{Run: w.run, Log: w.log, Offset: w.offset, Closed: true}
+}
+
+// Returns the lines of a log from the given offset, up to limit when it
+// is not negative. The lines of plain text logs have no time nor stream.
+func readLogLines(path string, offset, limit int) ([]LogLine, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	structured := strings.HasSuffix(path, logExtension)
+	lines := []LogLine{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 0; scanner.Scan() && (limit < 0 || n < limit); n++ {
+		if n < offset {
+			continue
+		}
+		var line LogLine
+		if !structured {
+			line.Line = scanner.Text()
+		} else if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// Returns the result of the run with the given log.
+func (r Run) Result(logFileName string) (*Result, bool) {
+	for _, result := range r.Results {
+		if result.LogFileName == logFileName {
+			return result, true
+		}
+	}
+	return nil, false
+}
+
+// Reads the log of a result, keeping only the lines of the given stream
+// unless it is empty.
+func (result *Result) ReadLog(stream string) ([]LogEntry, error) {
+	switch stream {
+	case "", Stdout, Stderr:
+	default:
+		return nil, errors.New("Unknown stream '" + stream + "'")
+	}
+	lines, err := readLogLines(filepath.Join(result.LogPath, result.LogFileName), 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	entries := []LogEntry{}
+	previous := result.Start
+	for i, line := range lines {
+		entry := LogEntry{LogLine: line, Offset: i}
+		if !line.Time.IsZero() {
+			entry.Elapsed = line.Time.Sub(result.Start).Seconds()
+			entry.Delta = line.Time.Sub(previous).Seconds()
+			previous = line.Time
+		}
+		if stream == "" || line.Stream == stream {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReadLog(t *testing.T) {
+	root, err := ioutil.TempDir("", "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	ioutil.WriteFile(filepath.Join(root, "t.jsonl"), []byte(
+		`{"time":"2016-01-01T10:00:01Z","stream":"stdout","line":"configure"}
+{"time":"2016-01-01T10:00:03Z","stream":"stderr","line":"warning"}
+{"time":"2016-01-01T10:00:06Z","stream":"stdout","line":"done"}
+`), 0644)
+	result := &Result{Start: time.Date(2016, 1, 1, 10, 0, 0, 0, time.UTC), LogPath: root, LogFileName: "t.jsonl"}
+
+	entries, err := result.ReadLog("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[2].Elapsed != 6 || entries[2].Delta != 3 {
+		t.Errorf("Unexpected entries %v", entries)
+	}
+
+	entries, err = result.ReadLog(Stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Line != "warning" || entries[0].Offset != 1 || entries[0].Delta != 2 {
+		t.Errorf("Unexpected stderr entries %v", entries)
+	}
+
+	if _, err := result.ReadLog("stdin"); err == nil {
+		t.Errorf("Unknown stream should be refused")
+	}
+}
@@ -36,6 +36,8 @@ func (n *Notifier) notifySlack(r *Run) {
 	var color string
 	if r.Status == "Done" {
 		color = "good"
+	} else if r.Status == "Cancelled" || r.Status == "PassedWithWarnings" || r.Status == "Interrupted" {
+		color = "warning"
 	} else {
 		color = "danger"
 	}
@@ -51,6 +53,15 @@ func (n *Notifier) notifySlack(r *Run) {
 		if result.Error != "" {
 			fieldText += fmt.Sprintf("\nError: %s", result.Error)
 		}
+		if result.Signal != "" {
+			fieldText += fmt.Sprintf("\nSignal: %s", result.Signal)
+		} else if result.ExitCode != nil && *result.ExitCode != 0 {
+			fieldText += fmt.Sprintf("\nExit code: %d", *result.ExitCode)
+		}
+		fieldText += fmt.Sprintf("\nCPU: %.2fs user, %.2fs system", result.UserTime, result.SystemTime)
+		if result.MaxRSS > 0 {
+			fieldText += fmt.Sprintf("\nMax RSS: %d KB", result.MaxRSS)
+		}
 		attachment.AddField(slack.Field{Title: "Task " + result.Task.Name, Value: fieldText})
 	}
 	payload := slack.Payload{
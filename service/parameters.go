@@ -0,0 +1,134 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Types of job parameters.
+const (
+	StringParameter  = "string"
+	BooleanParameter = "boolean"
+	ChoiceParameter  = "choice"
+)
+
+var identifier = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+
+// A value that can be given to a job when it is run, tasks find it in the
+// LIRICI_PARAM_<NAME> environment variable.
+type Parameter struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	Default     string `json:"default"`
+	// Values allowed for a choice parameter
+	Choices []string `json:"choices,omitempty"`
+	// Regular expression a string parameter must match, if any
+	Pattern string `json:"pattern,omitempty"`
+}
+
+// Checks that the parameter is well defined, including its default value.
+func (p Parameter) validateDefinition() error {
+	if !identifier.MatchString(p.Name) {
+		return fmt.Errorf("Invalid parameter name '%s'", p.Name)
+	}
+	switch p.Type {
+	case StringParameter, BooleanParameter:
+	case ChoiceParameter:
+		if len(p.Choices) == 0 {
+			return fmt.Errorf("Parameter '%s' has no choices", p.Name)
+		}
+	default:
+		return fmt.Errorf("Parameter '%s' has unknown type '%s'", p.Name, p.Type)
+	}
+	if p.Pattern != "" {
+		if _, err := regexp.Compile(p.Pattern); err != nil {
+			return fmt.Errorf("Parameter '%s' has an invalid pattern: %v", p.Name, err)
+		}
+	}
+	return p.validate(p.Default)
+}
+
+func (p Parameter) validate(value string) error {
+	switch p.Type {
+	case BooleanParameter:
+		if value != "true" && value != "false" {
+			return fmt.Errorf("Parameter '%s' must be 'true' or 'false'", p.Name)
+		}
+	case ChoiceParameter:
+		for _, choice := range p.Choices {
+			if value == choice {
+				return nil
+			}
+		}
+		return fmt.Errorf("Parameter '%s' must be one of: %s", p.Name, strings.Join(p.Choices, ", "))
+	case StringParameter:
+		if p.Pattern != "" {
+			matched, err := regexp.MatchString(p.Pattern, value)
+			if err != nil {
+				return err
+			}
+			if !matched {
+				return fmt.Errorf("Parameter '%s' must match '%s'", p.Name, p.Pattern)
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the value of every parameter of the job, taken from values or
+// from the defaults, after validating them.
+func (j Job) ResolveParameters(values map[string]string) (map[string]string, error) {
+	resolved := make(map[string]string)
+	for _, p := range j.Parameters {
+		value, found := values[p.Name]
+		if !found {
+			value = p.Default
+		}
+		if err := p.validate(value); err != nil {
+			return nil, err
+		}
+		resolved[p.Name] = value
+	}
+	for name := range values {
+		if _, found := resolved[name]; !found {
+			return nil, fmt.Errorf("Job '%s' has no parameter '%s'", j.Name, name)
+		}
+	}
+	return resolved, nil
+}
+
+// Keeps only the values of the parameters declared by the job.
+func (j Job) declaredParameters(values map[string]string) map[string]string {
+	declared := make(map[string]string)
+	for _, p := range j.Parameters {
+		if value, found := values[p.Name]; found {
+			declared[p.Name] = value
+		}
+	}
+	return declared
+}
+
+func (j Job) validateParameters() error {
+	names := make(map[string]bool)
+	for _, p := range j.Parameters {
+		if names[p.Name] {
+			return fmt.Errorf("Parameter '%s' is declared more than once", p.Name)
+		}
+		names[p.Name] = true
+		if err := p.validateDefinition(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the environment variables holding the parameters of a run.
+func parametersEnv(parameters map[string]string) map[string]string {
+	env := make(map[string]string)
+	for name, value := range parameters {
+		env["LIRICI_PARAM_"+strings.ToUpper(name)] = value
+	}
+	return env
+}
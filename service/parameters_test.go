@@ -0,0 +1,53 @@
+package service
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestResolveParameters(t *testing.T) {
+	job := Job{Name: "job", Parameters: []Parameter{
+		{Name: "branch", Type: StringParameter, Default: "master", Pattern: "^[a-z/]+$"},
+		{Name: "clean", Type: BooleanParameter, Default: "false"},
+		{Name: "target", Type: ChoiceParameter, Default: "x86_64", Choices: []string{"x86_64", "arm"}},
+	}}
+	if err := job.validateParameters(); err != nil {
+		t.Fatal(err)
+	}
+
+	resolved, err := job.ResolveParameters(map[string]string{"branch": "feature/x", "target": "arm"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"branch": "feature/x", "clean": "false", "target": "arm"}
+	if fmt.Sprintf("%v", resolved) != fmt.Sprintf("%v", expected) {
+		t.Errorf("Expected %v but got %v", expected, resolved)
+	}
+
+	invalid := []map[string]string{
+		{"branch": "Feature"},
+		{"clean": "yes"},
+		{"target": "mips"},
+		{"unknown": "value"},
+	}
+	for _, values := range invalid {
+		if _, err := job.ResolveParameters(values); err == nil {
+			t.Errorf("Expected %v to be rejected", values)
+		}
+	}
+}
+
+func TestInvalidParameterDefinitions(t *testing.T) {
+	jobs := []Job{
+		{Name: "name", Parameters: []Parameter{{Name: "1st", Type: StringParameter}}},
+		{Name: "type", Parameters: []Parameter{{Name: "p", Type: "number"}}},
+		{Name: "default", Parameters: []Parameter{{Name: "p", Type: BooleanParameter, Default: "maybe"}}},
+		{Name: "choices", Parameters: []Parameter{{Name: "p", Type: ChoiceParameter}}},
+		{Name: "duplicate", Parameters: []Parameter{{Name: "p", Type: StringParameter}, {Name: "p", Type: StringParameter}}},
+	}
+	for _, job := range jobs {
+		if err := job.validateParameters(); err == nil {
+			t.Errorf("Expected job '%s' to be rejected", job.Name)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Declarative description of the tasks, triggers and jobs of the server,
+// so that it can be kept under version control.
+type Pipeline struct {
+	Tasks    []Task    `json:"tasks"`
+	Triggers []Trigger `json:"triggers"`
+	Jobs     []Job     `json:"jobs"`
+}
+
+// Names of the elements of a kind that an import creates, updates or
+// deletes.
+type Changes struct {
+	Created []string `json:"created"`
+	Updated []string `json:"updated"`
+	Deleted []string `json:"deleted"`
+}
+
+// What importing a pipeline changes.
+type PipelineChanges struct {
+	Tasks    Changes `json:"tasks"`
+	Triggers Changes `json:"triggers"`
+	Jobs     Changes `json:"jobs"`
+	// Diff of the script of each updated task
+	Scripts map[string]string `json:"scripts,omitempty"`
+}
+
+// Returns the pipeline currently configured, without the state of the
+// jobs and the revisions of the tasks.
+func ExportPipeline(jobList *JobList, taskList *TaskList, triggerList *TriggerList) Pipeline {
+	p := Pipeline{Tasks: []Task{}, Triggers: []Trigger{}, Jobs: []Job{}}
+	for _, e := range taskList.Dump() {
+		p.Tasks = append(p.Tasks, normalizeTask(e.(Task)))
+	}
+	for _, e := range triggerList.Dump() {
+		p.Triggers = append(p.Triggers, normalizeTrigger(e.(Trigger)))
+	}
+	for _, e := range jobList.Dump() {
+		p.Jobs = append(p.Jobs, normalizeJob(e.(Job)))
+	}
+	sort.Slice(p.Tasks, func(i, j int) bool { return p.Tasks[i].Name < p.Tasks[j].Name })
+	sort.Slice(p.Triggers, func(i, j int) bool { return p.Triggers[i].Name < p.Triggers[j].Name })
+	sort.Slice(p.Jobs, func(i, j int) bool { return p.Jobs[i].Name < p.Jobs[j].Name })
+	return p
+}
+
+func normalizeTask(t Task) Task {
+	t.Revision = 0
+	if len(t.Env) == 0 {
+		t.Env = nil
+	}
+	if len(t.Artifacts) == 0 {
+		t.Artifacts = nil
+	}
+	return t
+}
+
+func normalizeTrigger(t Trigger) Trigger {
+	if len(t.Parameters) == 0 {
+		t.Parameters = nil
+	}
+	for _, filter := range []*[]string{&t.Events, &t.Branches, &t.Tags, &t.Paths} {
+		if len(*filter) == 0 {
+			*filter = nil
+		}
+	}
+	return t
+}
+
+func normalizeJob(j Job) Job {
+	j.Status = ""
+	if j.Tasks == nil {
+		j.Tasks = []JobTask{}
+	}
+	if j.Triggers == nil {
+		j.Triggers = []string{}
+	}
+	if len(j.Env) == 0 {
+		j.Env = nil
+	}
+	return j
+}
+
+// Tells whether two elements have the same JSON representation.
+func sameJSON(a, b interface{}) bool {
+	x, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	y, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// Checks that the names are unique and that every element is valid, jobs
+// can only use the tasks and triggers of the pipeline and triggers the
+// secrets already set.
+func (p Pipeline) Validate(secretList *SecretList) error {
+	taskList := &TaskList{list{elements: []elementer{}}}
+	for _, task := range p.Tasks {
+		if task.Name == "" {
+			return fmt.Errorf("A task has no name")
+		}
+		if _, err := taskList.Get(task.Name); err == nil {
+			return fmt.Errorf("Task '%s' is defined twice", task.Name)
+		}
+		if task.Timeout < 0 {
+			return fmt.Errorf("Timeout of task '%s' cannot be negative", task.Name)
+		}
+		if err := ValidateEnv(task.Env); err != nil {
+			return fmt.Errorf("Task '%s': %s", task.Name, err)
+		}
+		if err := ValidateArtifacts(task.Artifacts); err != nil {
+			return fmt.Errorf("Task '%s': %s", task.Name, err)
+		}
+		taskList.elements = append(taskList.elements, task)
+	}
+	triggers := make(map[string]bool)
+	for _, trigger := range p.Triggers {
+		if trigger.Name == "" {
+			return fmt.Errorf("A trigger has no name")
+		}
+		if triggers[trigger.Name] {
+			return fmt.Errorf("Trigger '%s' is defined twice", trigger.Name)
+		}
+		if err := ValidateTriggerType(trigger.Type); err != nil {
+			return fmt.Errorf("Trigger '%s': %s", trigger.Name, err)
+		}
+		if err := ValidateEventFilters(trigger); err != nil {
+			return fmt.Errorf("Trigger '%s': %s", trigger.Name, err)
+		}
+		if trigger.Secret != "" {
+			if _, err := secretList.Get(trigger.Secret); err != nil {
+				return fmt.Errorf("Trigger '%s': unknown secret '%s'", trigger.Name, trigger.Secret)
+			}
+		}
+		switch trigger.Type {
+		case "", CronTrigger:
+			if _, err := ParseSchedule(trigger.Schedule); err != nil {
+				return fmt.Errorf("Trigger '%s': %s", trigger.Name, err)
+			}
+		case PollTrigger:
+			if err := ValidateRepository(trigger.Repository); err != nil {
+				return fmt.Errorf("Trigger '%s': %s", trigger.Name, err)
+			}
+		}
+		triggers[trigger.Name] = true
+	}
+	jobs := make(map[string]bool)
+	for _, job := range p.Jobs {
+		if job.Name == "" {
+			return fmt.Errorf("A job has no name")
+		}
+		if jobs[job.Name] {
+			return fmt.Errorf("Job '%s' is defined twice", job.Name)
+		}
+		if err := job.Validate(taskList); err != nil {
+			return fmt.Errorf("Job '%s': %s", job.Name, err)
+		}
+		for _, trigger := range job.Triggers {
+			if !triggers[trigger] {
+				return fmt.Errorf("Job '%s': unknown trigger '%s'", job.Name, trigger)
+			}
+		}
+		jobs[job.Name] = true
+	}
+	return nil
+}
+
+// Compares the pipeline with the elements of a list.
+func changes(l *list, elements []elementer, same func(a, b elementer) bool) Changes {
+	c := Changes{Created: []string{}, Updated: []string{}, Deleted: []string{}}
+	wanted := make(map[string]bool)
+	for _, e := range elements {
+		wanted[e.ID()] = true
+		current, err := l.Get(e.ID())
+		switch {
+		case err != nil:
+			c.Created = append(c.Created, e.ID())
+		case !same(current, e):
+			c.Updated = append(c.Updated, e.ID())
+		}
+	}
+	for _, e := range l.Dump() {
+		if !wanted[e.ID()] {
+			c.Deleted = append(c.Deleted, e.ID())
+		}
+	}
+	return c
+}
+
+// Returns what importing the pipeline would change.
+func (p Pipeline) Changes(jobList *JobList, taskList *TaskList, triggerList *TriggerList) PipelineChanges {
+	var tasks, triggers, jobs []elementer
+	for _, t := range p.Tasks {
+		tasks = append(tasks, t)
+	}
+	for _, t := range p.Triggers {
+		triggers = append(triggers, t)
+	}
+	for _, j := range p.Jobs {
+		jobs = append(jobs, j)
+	}
+	c := PipelineChanges{
+		Tasks: changes(&taskList.list, tasks, func(a, b elementer) bool {
+			return sameJSON(normalizeTask(a.(Task)), normalizeTask(b.(Task)))
+		}),
+		Triggers: changes(&triggerList.list, triggers, func(a, b elementer) bool {
+			return sameJSON(normalizeTrigger(a.(Trigger)), normalizeTrigger(b.(Trigger)))
+		}),
+		Jobs: changes(&jobList.list, jobs, func(a, b elementer) bool {
+			return sameJSON(normalizeJob(a.(Job)), normalizeJob(b.(Job)))
+		}),
+	}
+	for _, t := range p.Tasks {
+		current, err := taskList.Get(t.Name)
+		if err != nil {
+			continue
+		}
+		if diff := unifiedDiff(t.Name, t.Name, current.(Task).Script, t.Script); diff != "" {
+			if c.Scripts == nil {
+				c.Scripts = make(map[string]string)
+			}
+			c.Scripts[t.Name] = diff
+		}
+	}
+	return c
+}
+
+// Makes the configured tasks, triggers and jobs match the pipeline. The
+// changes of the tasks are recorded as revisions of the given author and
+// the cron entries of the triggers are reconciled. The first error stops
+// the import, the changes made until then are kept.
+func (p Pipeline) Apply(jobList *JobList, taskList *TaskList, triggerList *TriggerList, secretList *SecretList, revisions *RevisionList, executor *Executor, author string) (PipelineChanges, error) {
+	if err := p.Validate(secretList); err != nil {
+		return PipelineChanges{}, err
+	}
+	c := p.Changes(jobList, taskList, triggerList)
+
+	for _, task := range p.Tasks {
+		task = normalizeTask(task)
+		current, err := taskList.Get(task.Name)
+		if err != nil {
+			task, err = revisions.Record(nil, task, author)
+			if err != nil {
+				return c, err
+			}
+			if err := taskList.Append(task); err != nil {
+				return c, err
+			}
+			continue
+		}
+		if sameJSON(normalizeTask(current.(Task)), task) {
+			continue
+		}
+		previous := current.(Task)
+		task, err = revisions.Record(&previous, task, author)
+		if err != nil {
+			return c, err
+		}
+		if err := taskList.Update(task); err != nil {
+			return c, err
+		}
+	}
+
+	for _, trigger := range p.Triggers {
+		var err error
+		if _, e := triggerList.Get(trigger.Name); e == nil {
+			err = triggerList.Update(trigger)
+		} else {
+			err = triggerList.Append(trigger)
+		}
+		if err != nil {
+			return c, err
+		}
+	}
+
+	for _, job := range p.Jobs {
+		current, err := jobList.Get(job.Name)
+		if err != nil {
+			job.Status = "New"
+			err = jobList.Append(job)
+		} else {
+			job.Status = current.(Job).Status
+			err = jobList.Update(job)
+		}
+		if err != nil {
+			return c, err
+		}
+	}
+	for _, name := range c.Jobs.Deleted {
+		if err := jobList.Delete(name); err != nil {
+			return c, err
+		}
+	}
+	for _, name := range c.Triggers.Deleted {
+		if err := triggerList.Delete(name); err != nil {
+			return c, err
+		}
+	}
+	for _, name := range c.Tasks.Deleted {
+		if err := taskList.Delete(name); err != nil {
+			return c, err
+		}
+		revisions.Delete(name)
+	}
+	executor.Reconcile()
+	for _, name := range c.Triggers.Deleted {
+		executor.DeletePollState(name)
+	}
+	return c, nil
+}
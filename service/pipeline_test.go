@@ -0,0 +1,83 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPipelineValidate(t *testing.T) {
+	p := Pipeline{
+		Tasks:    []Task{{Name: "build", Script: "make"}},
+		Triggers: []Trigger{{Name: "nightly", Schedule: "0 0 2 * * *"}},
+		Jobs:     []Job{{Name: "ci", Tasks: []JobTask{{Name: "build"}}, Triggers: []string{"nightly"}}},
+	}
+	secretList := NewSecretList("", "")
+	secretList.elements = []elementer{Secret{Name: "hook"}}
+	if err := p.Validate(secretList); err != nil {
+		t.Fatal(err)
+	}
+
+	p.Jobs[0].Triggers = []string{"hourly"}
+	if err := p.Validate(secretList); err == nil {
+		t.Error("Job with an unknown trigger should be invalid")
+	}
+	p.Jobs[0].Triggers = nil
+	p.Jobs[0].Tasks = []JobTask{{Name: "test"}}
+	if err := p.Validate(secretList); err == nil {
+		t.Error("Job with an unknown task should be invalid")
+	}
+	p.Jobs[0].Tasks = nil
+	p.Tasks = append(p.Tasks, Task{Name: "build"})
+	if err := p.Validate(secretList); err == nil {
+		t.Error("Task defined twice should be invalid")
+	}
+	p.Tasks = p.Tasks[:1]
+	p.Triggers[0].Schedule = "never"
+	if err := p.Validate(secretList); err == nil {
+		t.Error("Trigger with a bad schedule should be invalid")
+	}
+	p.Triggers[0] = Trigger{Name: "nightly", Type: WebhookTrigger, Secret: "hook"}
+	if err := p.Validate(secretList); err != nil {
+		t.Errorf("Webhook with a known secret should be valid: %v", err)
+	}
+	p.Triggers[0].Secret = "unknown"
+	if err := p.Validate(secretList); err == nil {
+		t.Error("Trigger with an unknown secret should be invalid")
+	}
+}
+
+func TestPipelineChanges(t *testing.T) {
+	taskList := NewTaskList("")
+	taskList.elements = []elementer{
+		Task{Name: "build", Script: "make\n", Revision: 3},
+		Task{Name: "lint", Script: "vet"},
+	}
+	triggerList := NewTriggerList("")
+	jobList := NewJobList("")
+	jobList.elements = []elementer{Job{Name: "ci", Status: "Ok", Tasks: []JobTask{{Name: "build"}}}}
+
+	exported := ExportPipeline(jobList, taskList, triggerList)
+	if exported.Tasks[0].Revision != 0 || exported.Jobs[0].Status != "" {
+		t.Errorf("Export should not include revisions nor statuses: %v", exported)
+	}
+	c := exported.Changes(jobList, taskList, triggerList)
+	if len(c.Tasks.Created)+len(c.Tasks.Updated)+len(c.Tasks.Deleted)+len(c.Jobs.Updated) != 0 {
+		t.Errorf("Exported pipeline should not change anything: %v", c)
+	}
+
+	p := Pipeline{
+		Tasks: []Task{{Name: "build", Script: "make -j4\n"}, {Name: "test", Script: "make test"}},
+		Jobs:  []Job{{Name: "ci", Tasks: []JobTask{{Name: "build"}, {Name: "test"}}}},
+	}
+	c = p.Changes(jobList, taskList, triggerList)
+	expected := Changes{Created: []string{"test"}, Updated: []string{"build"}, Deleted: []string{"lint"}}
+	if !reflect.DeepEqual(c.Tasks, expected) {
+		t.Errorf("Expected task changes %v, got %v", expected, c.Tasks)
+	}
+	if !reflect.DeepEqual(c.Jobs.Updated, []string{"ci"}) {
+		t.Errorf("Expected job ci to be updated, got %v", c.Jobs)
+	}
+	if c.Scripts["build"] != "--- build\n+++ build\n@@ -1,1 +1,1 @@\n-make\n+make -j4\n" {
+		t.Errorf("Unexpected script diff:\n%s", c.Scripts["build"])
+	}
+}
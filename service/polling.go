@@ -0,0 +1,176 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Seconds between two polls of a repository when the trigger sets none.
+const defaultPollInterval = 60
+
+// The branch heads of the repository of a polling trigger, as last seen.
+type PollState struct {
+	Trigger string    `json:"trigger"`
+	Polled  time.Time `json:"polled"`
+	// Repository the heads come from
+	Repository string `json:"repository"`
+	// Commit SHA of each branch
+	Heads map[string]string `json:"heads"`
+}
+
+func (s PollState) ID() string {
+	return s.Trigger
+}
+
+type PollList struct {
+	list
+}
+
+func NewPollList(rootPath string) *PollList {
+	return &PollList{
+		list{elements: []elementer{}, fileName: filepath.Join(rootPath, pollsFile)},
+	}
+}
+
+func (l *PollList) Load() {
+	bytes := readFile(l.fileName)
+	var states []PollState
+	err := json.Unmarshal([]byte(string(bytes)), &states)
+	if err != nil {
+		panic(err)
+	}
+	l.elements = []elementer{}
+	for _, state := range states {
+		l.elements = append(l.elements, state)
+	}
+}
+
+func (l *PollList) set(state PollState) error {
+	if _, err := l.Get(state.Trigger); err == nil {
+		return l.Update(state)
+	}
+	return l.Append(state)
+}
+
+// Checks the repository of a polling trigger. Only repositories on the
+// build host can be polled, given as a path or as a file:// URL.
+func ValidateRepository(repository string) error {
+	switch {
+	case repository == "":
+		return errors.New("Please provide a 'repository'")
+	case strings.HasPrefix(repository, "-"):
+		return fmt.Errorf("Invalid repository '%s'", repository)
+	case strings.Contains(repository, "://") && !strings.HasPrefix(repository, "file://"):
+		return fmt.Errorf("Only local repositories can be polled, not '%s'", repository)
+	}
+	return nil
+}
+
+// Returns the commit SHA of each branch of a repository.
+func listHeads(repository string) (map[string]string, error) {
+	if err := ValidateRepository(repository); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("git", "-c", "protocol.allow=never", "-c", "protocol.file.allow=always",
+		"ls-remote", "--heads", repository)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("Cannot list the branches of %s: %v %s", repository, err, strings.TrimSpace(stderr.String()))
+	}
+	heads := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.HasPrefix(fields[1], "refs/heads/") {
+			heads[strings.TrimPrefix(fields[1], "refs/heads/")] = fields[0]
+		}
+	}
+	return heads, nil
+}
+
+// Returns a push event for each branch whose head is not the one seen
+// before, with the previous head when the branch already existed.
+func movedBranches(trigger string, previous, current map[string]string) []*Event {
+	var events []*Event
+	for branch, sha := range current {
+		if previous[branch] == sha {
+			continue
+		}
+		events = append(events, &Event{
+			Trigger:  trigger,
+			Received: time.Now(),
+			Kind:     PushEvent,
+			Ref:      "refs/heads/" + branch,
+			Branch:   branch,
+			SHA:      sha,
+			Before:   previous[branch],
+		})
+	}
+	return events
+}
+
+// Lists the branches of the repository of a polling trigger and runs its
+// jobs for each matching branch that moved since the last poll. The first
+// poll, and the first one after the repository changed, only record the
+// heads.
+func (e *Executor) poll(name string) {
+	e.pollLock.Lock()
+	defer e.pollLock.Unlock()
+
+	t, err := e.triggerList.Get(name)
+	if err != nil {
+		return
+	}
+	trigger := t.(Trigger)
+	heads, err := listHeads(trigger.Repository)
+	if err != nil {
+		log.Printf("Error polling trigger %s: %v\n", name, err)
+		return
+	}
+	for branch := range heads {
+		if len(trigger.Branches) > 0 && !matchAny(trigger.Branches, branch) {
+			delete(heads, branch)
+		}
+	}
+
+	state := PollState{Trigger: name, Polled: time.Now(), Repository: trigger.Repository, Heads: heads}
+	if s, err := e.pollList.Get(name); err == nil && s.(PollState).Repository == trigger.Repository {
+		for _, event := range movedBranches(name, s.(PollState).Heads, heads) {
+			log.Printf("Branch %s of %s moved to %s\n", event.Branch, trigger.Repository, event.SHA)
+			e.findAndRun(name, event)
+		}
+	}
+	if err := e.pollList.set(state); err != nil {
+		log.Printf("Error saving the heads of trigger %s: %v\n", name, err)
+	}
+}
+
+// Returns the branch heads last seen by a polling trigger.
+func (e *Executor) PollState(name string) (PollState, error) {
+	s, err := e.pollList.Get(name)
+	if err != nil {
+		return PollState{}, fmt.Errorf("Trigger '%s' has not polled yet", name)
+	}
+	return s.(PollState), nil
+}
+
+// Forgets the branch heads seen by a trigger, so that a trigger created
+// again with the same name starts afresh.
+func (e *Executor) DeletePollState(name string) {
+	e.pollLock.Lock()
+	defer e.pollLock.Unlock()
+
+	e.pollList.Delete(name)
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// Runs git commands in a repository, skipping the test when git is not
+// available.
+func git(t *testing.T, repository string, commands ...[]string) {
+	for _, args := range commands {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repository
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Skipf("git %v: %v %s", args, err, out)
+		}
+	}
+}
+
+var commit = []string{"-c", "user.name=ci", "-c", "user.email=ci@localhost", "commit", "-q", "--allow-empty", "-m", "commit"}
+
+func TestListHeads(t *testing.T) {
+	repository, err := ioutil.TempDir("", "polling")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repository)
+	git(t, repository, []string{"init", "-q", "-b", "main"}, commit, []string{"branch", "release"})
+
+	heads, err := listHeads("file://" + repository)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(heads) != 2 || heads["main"] == "" || heads["main"] != heads["release"] {
+		t.Errorf("Unexpected heads %v", heads)
+	}
+	if _, err := listHeads("https://example.com/repo.git"); err == nil {
+		t.Error("Remote repositories should not be polled")
+	}
+}
+
+func TestMovedBranches(t *testing.T) {
+	previous := map[string]string{"main": "1111", "release": "2222"}
+	current := map[string]string{"main": "3333", "release": "2222", "feature": "4444"}
+	events := movedBranches("poll", previous, current)
+	if len(events) != 2 {
+		t.Fatalf("Expected 2 moved branches, got %d", len(events))
+	}
+	for _, event := range events {
+		switch event.Branch {
+		case "main":
+			if event.Before != "1111" || event.SHA != "3333" || event.Ref != "refs/heads/main" {
+				t.Errorf("Unexpected event %+v", event)
+			}
+		case "feature":
+			if event.Before != "" || event.SHA != "4444" {
+				t.Errorf("Unexpected event %+v", event)
+			}
+		default:
+			t.Errorf("Branch %s did not move", event.Branch)
+		}
+	}
+}
+
+func TestPoll(t *testing.T) {
+	runList, cleanup := newTestRunList(t)
+	defer cleanup()
+	root := runList.notifier.settings.Server.DbRootPath
+	var repositories []string
+	for _, name := range []string{"first", "second"} {
+		repository := filepath.Join(root, name)
+		os.Mkdir(repository, os.ModePerm)
+		git(t, repository, []string{"init", "-q", "-b", "main"}, commit)
+		repositories = append(repositories, repository)
+	}
+	// The heads of the repositories differ
+	git(t, repositories[0], commit)
+
+	triggerList := NewTriggerList(root)
+	triggerList.Append(Trigger{Name: "poll", Type: PollTrigger, Repository: repositories[0]})
+	runList.jobList.Append(Job{Name: "job", Triggers: []string{"poll"}})
+	e := &Executor{
+		settings:    runList.notifier.settings,
+		jobList:     runList.jobList,
+		taskList:    NewTaskList(root),
+		runList:     runList,
+		triggerList: triggerList,
+		pollList:    NewPollList(root),
+	}
+	e.queueCond = sync.NewCond(&e.queueLock)
+
+	// The heads of another repository are not compared with the ones seen
+	// before
+	e.poll("poll")
+	triggerList.Update(Trigger{Name: "poll", Type: PollTrigger, Repository: repositories[1]})
+	e.poll("poll")
+	if len(e.queue) != 0 {
+		t.Errorf("No branch moved yet, got runs %v", e.queue)
+	}
+	git(t, repositories[1], commit)
+	e.poll("poll")
+	if len(e.queue) != 1 {
+		t.Errorf("Expected a run for the branch that moved, got %v", e.queue)
+	}
+	state, err := e.PollState("poll")
+	if err != nil || state.Repository != repositories[1] {
+		t.Errorf("Unexpected state %v %v", state, err)
+	}
+
+	e.DeletePollState("poll")
+	if _, err := e.PollState("poll"); err == nil {
+		t.Error("State of a deleted trigger should be forgotten")
+	}
+}
@@ -0,0 +1,52 @@
+//go:build !windows
+// +build !windows
+
+package service
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+)
+
+// Puts the command in a process group of its own, so that every process
+// spawned by the task script can be signalled at once.
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// Kills the whole process group of a started command.
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return errors.New("Process not started")
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// Asks the whole process group of a started command to terminate.
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return errors.New("Process not started")
+	}
+	return syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+}
+
+// Returns the name of the signal that terminated the process, if any, and
+// its peak resident set size in kilobytes.
+func processUsage(state *os.ProcessState) (string, int64) {
+	var signal string
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+		signal = status.Signal().String()
+	}
+	var maxRSS int64
+	if usage, ok := state.SysUsage().(*syscall.Rusage); ok {
+		maxRSS = int64(usage.Maxrss)
+		if runtime.GOOS == "darwin" {
+			// Reported in bytes instead of kilobytes
+			maxRSS /= 1024
+		}
+	}
+	return signal, maxRSS
+}
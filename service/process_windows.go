@@ -0,0 +1,28 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// Process groups are not available, only the shell itself is tracked.
+func setProcessGroup(cmd *exec.Cmd) {
+}
+
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return errors.New("Process not started")
+	}
+	return cmd.Process.Kill()
+}
+
+// There is no graceful termination, the process is killed right away.
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	return killProcessGroup(cmd)
+}
+
+// Processes are not terminated by signals and memory usage is not reported.
+func processUsage(state *os.ProcessState) (string, int64) {
+	return "", 0
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Returns the positions of the tasks whose last attempt succeeded, or
+// that were reused by the run.
+func succeededTasks(r Run) []int {
+	last := make(map[string]*Result)
+	for _, result := range r.Results {
+		last[result.Task.Name] = result
+	}
+	reused := make(map[int]bool)
+	for _, position := range r.Reused {
+		reused[position] = true
+	}
+	var positions []int
+	for i, task := range r.Tasks {
+		if result, ok := last[task.Name]; reused[i] || (ok && !result.End.IsZero() && result.Error == "") {
+			positions = append(positions, i)
+		}
+	}
+	return positions
+}
+
+// Adds a run executing again the tasks and parameters of another one.
+// When fromFailed is set the tasks that succeeded are not executed again.
+func (l *RunList) AddRerun(UUID string, original Run, fromFailed bool) error {
+	if original.End.IsZero() {
+		return errors.New("Run is not over")
+	}
+	var reused []int
+	if fromFailed {
+		succeeded := succeededTasks(original)
+		if len(succeeded) == len(original.Tasks) {
+			return errors.New("Run has no failed task")
+		}
+		// Tasks that always run, such as cleanups, are executed again
+		for _, position := range succeeded {
+			if position >= len(original.Job.Tasks) || !original.Job.Tasks[position].AlwaysRun {
+				reused = append(reused, position)
+			}
+		}
+	}
+	event, err := eventOf(l.notifier.settings, original)
+	if err != nil {
+		return err
+	}
+	run := Run{
+		UUID:       UUID,
+		Job:        original.Job,
+		Tasks:      original.Tasks,
+		Parameters: original.Parameters,
+		RerunOf:    original.UUID,
+		Reused:     reused,
+		Event:      event,
+	}
+	return l.add(run)
+}
+
+// Copies the workspace of the original run of a rerun that skips tasks,
+// so that the other tasks find the files they left.
+func (l *RunList) seedWorkspace(r *Run, w workspace) error {
+	if r.RerunOf == "" || len(r.Reused) == 0 || r.Job.Workspace == PersistentWorkspace {
+		return nil
+	}
+	e, err := l.Get(r.RerunOf)
+	if err != nil {
+		return nil
+	}
+	original := runWorkspace(l.notifier.settings, &Run{UUID: e.ID(), Job: e.(Run).Job})
+	return copyTree(original.Dir, w.Dir)
+}
+
+func copyTree(src, dst string) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == src {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+		switch {
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+func copyFile(src, dst string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
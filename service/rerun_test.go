@@ -0,0 +1,53 @@
+package service
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSucceededTasks(t *testing.T) {
+	end := time.Now()
+	run := Run{
+		Tasks: []Task{{Name: "checkout"}, {Name: "build"}, {Name: "test"}, {Name: "deploy"}},
+		Results: []*Result{
+			{Task: Task{Name: "build"}, End: end, Error: "exit status 1"},
+			{Task: Task{Name: "build"}, End: end},
+			{Task: Task{Name: "test"}, End: end, Error: "exit status 2"},
+		},
+		Reused: []int{0},
+	}
+	if positions := succeededTasks(run); !reflect.DeepEqual(positions, []int{0, 1}) {
+		t.Errorf("Expected checkout and build to be reused, got %v", positions)
+	}
+}
+
+func TestRerunFromFailed(t *testing.T) {
+	l, cleanup := newTestRunList(t)
+	defer cleanup()
+
+	end := time.Now()
+	run := Run{
+		UUID:  "original",
+		Job:   Job{Name: "job", Tasks: []JobTask{{Name: "build"}, {Name: "test"}, {Name: "cleanup", AlwaysRun: true}}},
+		Tasks: []Task{{Name: "build"}, {Name: "test"}, {Name: "cleanup"}},
+		End:   end,
+		Results: []*Result{
+			{Task: Task{Name: "build"}, End: end},
+			{Task: Task{Name: "test"}, End: end, Error: "exit status 1"},
+			{Task: Task{Name: "cleanup"}, End: end},
+		},
+	}
+	if err := l.AddRerun("rerun", run, true); err != nil {
+		t.Fatal(err)
+	}
+	e, _ := l.Get("rerun")
+	if reused := e.(Run).Reused; !reflect.DeepEqual(reused, []int{0}) {
+		t.Errorf("Expected only build to be reused, not the cleanup task, got %v", reused)
+	}
+
+	run.Results[1].Error = ""
+	if err := l.AddRerun("again", run, true); err == nil {
+		t.Error("Run without failed task should not be rerun from the failed tasks")
+	}
+}
@@ -0,0 +1,118 @@
+package service
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// What a housekeeping pass removed.
+type HousekeepingReport struct {
+	Time time.Time `json:"time"`
+	// Number of runs deleted
+	Runs int `json:"runs"`
+	// Size of the logs, artifacts and workspaces deleted
+	Bytes int64 `json:"bytes"`
+}
+
+// Returns when a run started, or ended for the runs cancelled before they
+// started.
+func (r Run) started() time.Time {
+	if r.Start.IsZero() {
+		return r.End
+	}
+	return r.Start
+}
+
+// Returns the finished runs that no retention rule keeps. A run is kept
+// when it is one of the keepRuns most recent runs of its job, when it
+// ended less than keepDays days ago, or when it is the last successful or
+// the last failed run of its job. Nothing expires without any rule.
+func expiredRuns(runs []Run, keepRuns, keepDays int, now time.Time) []Run {
+	if keepRuns <= 0 && keepDays <= 0 {
+		return nil
+	}
+	byJob := make(map[string][]Run)
+	for _, run := range runs {
+		byJob[run.Job.Name] = append(byJob[run.Job.Name], run)
+	}
+	limit := now.AddDate(0, 0, -keepDays)
+
+	var expired []Run
+	for _, jobRuns := range byJob {
+		// Runs recorded before runs were queued have no queue time
+		sort.SliceStable(jobRuns, func(i, j int) bool { return jobRuns[i].started().After(jobRuns[j].started()) })
+		succeeded, failed := false, false
+		for i, run := range jobRuns {
+			keep := run.End.IsZero() ||
+				(keepRuns > 0 && i < keepRuns) ||
+				(keepDays > 0 && run.End.After(limit))
+			switch run.Status {
+			case "Done", "PassedWithWarnings":
+				keep = keep || !succeeded
+				succeeded = true
+			case "Failed", "TimedOut":
+				keep = keep || !failed
+				failed = true
+			}
+			if !keep {
+				expired = append(expired, run)
+			}
+		}
+	}
+	return expired
+}
+
+// Deletes the expired runs together with their logs, artifacts and
+// workspaces.
+func (l *RunList) prune(settings *Settings) HousekeepingReport {
+	report := HousekeepingReport{Time: time.Now()}
+	var runs []Run
+	for _, e := range l.Dump() {
+		runs = append(runs, e.(Run))
+	}
+	expired := expiredRuns(runs, settings.Retention.KeepRuns, settings.Retention.KeepDays, report.Time)
+	if len(expired) == 0 {
+		return report
+	}
+
+	ids := make(map[string]bool)
+	var uuids []string
+	for _, run := range expired {
+		ids[run.UUID] = true
+		uuids = append(uuids, run.UUID)
+		for _, path := range []string{
+			filepath.Join(settings.Server.OutputPath, "files", "logs", run.UUID),
+			ArtifactsPath(settings, run.UUID),
+			filepath.Join(workspacesPath(settings), "runs", run.UUID),
+		} {
+			size := diskUsage(path)
+			if err := os.RemoveAll(path); err != nil {
+				log.Println("Cannot remove", path, err)
+				continue
+			}
+			report.Bytes += size
+		}
+	}
+	l.deleteAll(ids)
+	if err := l.index.Remove(uuids...); err != nil {
+		log.Println("Cannot update log index:", err)
+	}
+	report.Runs = len(expired)
+	log.Printf("Housekeeping deleted %d runs, reclaiming %d bytes\n", report.Runs, report.Bytes)
+	return report
+}
+
+// Returns the size of the files under a path.
+func diskUsage(path string) int64 {
+	var size int64
+	filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,60 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiredRuns(t *testing.T) {
+	now := time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC)
+	run := func(uuid, job, status string, days int) Run {
+		date := now.AddDate(0, 0, -days)
+		r := Run{UUID: uuid, Job: Job{Name: job}, Status: status, Queued: date, Start: date}
+		if status != "Running" {
+			r.End = date
+		}
+		return r
+	}
+	runs := []Run{
+		run("running", "a", "Running", 40),
+		run("recent", "a", "Failed", 1),
+		run("last", "a", "Done", 2),
+		run("failed", "a", "Failed", 10),
+		run("old", "a", "Done", 20),
+		run("cancelled", "a", "Cancelled", 30),
+		run("other", "b", "Done", 50),
+	}
+
+	expired := func(keepRuns, keepDays int) map[string]bool {
+		ids := make(map[string]bool)
+		for _, r := range expiredRuns(runs, keepRuns, keepDays, now) {
+			ids[r.UUID] = true
+		}
+		return ids
+	}
+
+	if ids := expired(0, 0); len(ids) != 0 {
+		t.Errorf("Runs expired without retention rules: %v", ids)
+	}
+	if ids := expired(1, 0); len(ids) != 3 || !ids["failed"] || !ids["old"] || !ids["cancelled"] {
+		t.Errorf("Unexpected expired runs when keeping 1 run: %v", ids)
+	}
+	if ids := expired(0, 25); len(ids) != 1 || !ids["cancelled"] {
+		t.Errorf("Unexpected expired runs when keeping 25 days: %v", ids)
+	}
+
+	// Runs recorded before they were queued are ordered by their start,
+	// a run cancelled while queued by its end
+	legacy := []Run{
+		{UUID: "older", Job: Job{Name: "c"}, Status: "Cancelled", Start: now.AddDate(0, 0, -3), End: now.AddDate(0, 0, -3)},
+		{UUID: "newer", Job: Job{Name: "c"}, Status: "Cancelled", Start: now.AddDate(0, 0, -1), End: now.AddDate(0, 0, -1)},
+		{UUID: "dequeued", Job: Job{Name: "c"}, Status: "Cancelled", Queued: now.AddDate(0, 0, -5), End: now.AddDate(0, 0, -2)},
+	}
+	ids := make(map[string]bool)
+	for _, r := range expiredRuns(legacy, 2, 0, now) {
+		ids[r.UUID] = true
+	}
+	if len(ids) != 1 || !ids["older"] {
+		t.Errorf("Unexpected expired runs without queue time: %v", ids)
+	}
+}
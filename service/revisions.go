@@ -0,0 +1,124 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"time"
+)
+
+// A version of a task, recorded each time the task is changed.
+type Revision struct {
+	// Starts from 1
+	Number int       `json:"number"`
+	Time   time.Time `json:"time"`
+	Author string    `json:"author,omitempty"`
+	// The task as it was, with Revision set to Number
+	Task Task `json:"task"`
+}
+
+// The revisions of a task, oldest first.
+type TaskHistory struct {
+	Name      string     `json:"name"`
+	Revisions []Revision `json:"revisions"`
+}
+
+func (h TaskHistory) ID() string {
+	return h.Name
+}
+
+type RevisionList struct {
+	list
+}
+
+func NewRevisionList(rootPath string) *RevisionList {
+	return &RevisionList{
+		list{elements: []elementer{}, fileName: filepath.Join(rootPath, revisionsFile)},
+	}
+}
+
+func (l *RevisionList) Load() {
+	bytes := readFile(l.fileName)
+	var histories []TaskHistory
+	err := json.Unmarshal([]byte(string(bytes)), &histories)
+	if err != nil {
+		panic(err)
+	}
+	l.elements = []elementer{}
+	for _, history := range histories {
+		l.elements = append(l.elements, history)
+	}
+}
+
+// Returns the revisions of a task, oldest first.
+func (l *RevisionList) Revisions(name string) []Revision {
+	e, err := l.Get(name)
+	if err != nil {
+		return []Revision{}
+	}
+	return e.(TaskHistory).Revisions
+}
+
+func (l *RevisionList) Revision(name string, number int) (Revision, error) {
+	for _, revision := range l.Revisions(name) {
+		if revision.Number == number {
+			return revision, nil
+		}
+	}
+	return Revision{}, fmt.Errorf("Task '%s' has no revision %d", name, number)
+}
+
+// Records a new version of a task and returns it with its revision
+// number. The previous version of a task changed before revisions were
+// kept is recorded first, without time nor author. Nothing is recorded
+// when the task didn't change.
+func (l *RevisionList) Record(previous *Task, task Task, author string) (Task, error) {
+	var history TaskHistory
+	e, err := l.Get(task.Name)
+	exists := err == nil
+	if exists {
+		history = e.(TaskHistory)
+	} else {
+		history.Name = task.Name
+	}
+
+	if len(history.Revisions) == 0 && previous != nil {
+		p := *previous
+		p.Revision = 1
+		history.Revisions = append(history.Revisions, Revision{Number: 1, Task: p})
+	}
+	if n := len(history.Revisions); n > 0 {
+		task.Revision = history.Revisions[n-1].Number
+		if reflect.DeepEqual(task, history.Revisions[n-1].Task) {
+			return task, nil
+		}
+	}
+	task.Revision = len(history.Revisions) + 1
+	history.Revisions = append(history.Revisions, Revision{
+		Number: task.Revision,
+		Time:   time.Now(),
+		Author: author,
+		Task:   task,
+	})
+
+	if exists {
+		err = l.Update(history)
+	} else {
+		err = l.Append(history)
+	}
+	return task, err
+}
+
+// Returns the unified diff between the scripts of two revisions of a task.
+func (l *RevisionList) Diff(name string, from, to int) (string, error) {
+	a, err := l.Revision(name, from)
+	if err != nil {
+		return "", err
+	}
+	b, err := l.Revision(name, to)
+	if err != nil {
+		return "", err
+	}
+	return unifiedDiff(fmt.Sprintf("%s@%d", name, from), fmt.Sprintf("%s@%d", name, to), a.Task.Script, b.Task.Script), nil
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestRecordRevisions(t *testing.T) {
+	root, err := ioutil.TempDir("", "revisions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	revisions := NewRevisionList(root)
+
+	// The task existed before revisions were kept
+	previous := Task{Name: "build", Script: "make"}
+	task, err := revisions.Record(&previous, Task{Name: "build", Script: "make -j4"}, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if task.Revision != 2 {
+		t.Errorf("Expected revision 2, got %d", task.Revision)
+	}
+	task, _ = revisions.Record(&task, task, "bob")
+	if task.Revision != 2 || len(revisions.Revisions("build")) != 2 {
+		t.Errorf("Unchanged task recorded as revision %d", task.Revision)
+	}
+
+	history := revisions.Revisions("build")
+	if history[0].Task.Script != "make" || history[0].Author != "" || history[1].Author != "alice" {
+		t.Errorf("Unexpected revisions %v", history)
+	}
+	if diff, _ := revisions.Diff("build", 1, 2); diff != "--- build@1\n+++ build@2\n@@ -1,1 +1,1 @@\n-make\n+make -j4\n" {
+		t.Errorf("Unexpected diff:\n%s", diff)
+	}
+	if _, err := revisions.Diff("build", 1, 3); err == nil {
+		t.Errorf("Diff with an unknown revision should fail")
+	}
+}
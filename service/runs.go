@@ -4,12 +4,16 @@ import (
 	"bufio"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"syscall"
 	"time"
 )
 
@@ -20,33 +24,99 @@ type Result struct {
 	LogPath     string    `json:"logpath"`
 	LogFileName string    `json:"logfilename"`
 	Error       string    `json:"error"`
+	// Starts from 1, incremented each time the task is retried
+	Attempt int `json:"attempt"`
+	// Only set once the process exited, -1 when it was terminated by a
+	// signal
+	ExitCode *int   `json:"exit_code,omitempty"`
+	Signal   string `json:"signal,omitempty"`
+	// CPU time in seconds
+	UserTime   float64 `json:"user_time"`
+	SystemTime float64 `json:"system_time"`
+	// Peak resident set size in kilobytes
+	MaxRSS int64 `json:"max_rss"`
+	// Environment of the task, sensitive values are redacted
+	Env map[string]string `json:"env,omitempty"`
+	// Secret values hidden from the log
+	masks []string
+}
+
+// Records how the process of the task exited and the resources it used.
+func (result *Result) setProcessState(state *os.ProcessState) {
+	code := -1
+	if status, ok := state.Sys().(syscall.WaitStatus); ok && status.Exited() {
+		code = status.ExitStatus()
+	}
+	result.ExitCode = &code
+	result.Signal, result.MaxRSS = processUsage(state)
+	result.UserTime = state.UserTime().Seconds()
+	result.SystemTime = state.SystemTime().Seconds()
 }
 
 type Run struct {
 	UUID    string    `json:"uuid"`
 	Job     Job       `json:"job"`
 	Tasks   []Task    `json:"tasks"`
+	Queued  time.Time `json:"queued"`
 	Start   time.Time `json:"start"`
 	End     time.Time `json:"end"`
 	Results []*Result `json:"results"`
 	Status  string    `json:"status"`
+	// Values of the job parameters
+	Parameters map[string]string `json:"parameters,omitempty"`
+	// Working directory of the tasks
+	Workspace string `json:"workspace,omitempty"`
+	// Files kept from the workspace, see ArtifactsPath
+	Artifacts []Artifact `json:"artifacts,omitempty"`
+	// UUID of the run this one executes again
+	RerunOf string `json:"rerun_of,omitempty"`
+	// Positions of the tasks that succeeded in the original run and are
+	// not executed again
+	Reused []int `json:"reused,omitempty"`
+	// What fired the trigger that started the run, if any
+	Event *Event `json:"event,omitempty"`
+	// Position in the Executor queue, only set while the run is queued
+	Position int `json:"position,omitempty"`
 }
 
 func (r Run) ID() string {
 	return r.UUID
 }
 
+// Returns a copy of the run that doesn't share its results.
+func (r *Run) snapshot() Run {
+	s := *r
+	s.Results = make([]*Result, len(r.Results))
+	for i, result := range r.Results {
+		copied := *result
+		s.Results[i] = &copied
+	}
+	return s
+}
+
 type RunList struct {
 	list
-	notifier *Notifier
-	jobList  *JobList
+	notifier   *Notifier
+	jobList    *JobList
+	secretList *SecretList
+	executions map[string]*execution
+	execLock   sync.Mutex
+	// Lines of the task logs, consumed by the Hub
+	logs  chan logEvent
+	index *LogIndex
+	// Runs that were running when the server stopped
+	interrupted []Run
 }
 
-func NewRunList(rootPath string, notifier *Notifier, jobList *JobList) *RunList {
+func NewRunList(rootPath string, notifier *Notifier, jobList *JobList, secretList *SecretList) *RunList {
 	return &RunList{
-		list{elements: []elementer{}, fileName: filepath.Join(rootPath, runsFile)},
-		notifier,
-		jobList,
+		list:       list{elements: []elementer{}, fileName: filepath.Join(rootPath, runsFile)},
+		notifier:   notifier,
+		jobList:    jobList,
+		secretList: secretList,
+		executions: make(map[string]*execution),
+		logs:       make(chan logEvent, 1024),
+		index:      NewLogIndex(rootPath),
 	}
 }
 
@@ -61,6 +131,45 @@ func (l *RunList) Load() {
 	for _, run := range runs {
 		l.elements = append(l.elements, run)
 	}
+	l.index.Load()
+	go l.indexLogs()
+	l.recover()
+}
+
+// Marks the runs that were running when the server stopped as interrupted.
+func (l *RunList) recover() {
+	for _, e := range l.Dump() {
+		run := e.(Run)
+		if run.Status != "Running" {
+			continue
+		}
+		for _, result := range run.Results {
+			if result.End.IsZero() {
+				result.End = time.Now()
+				result.Error = errInterrupted.Error()
+			}
+		}
+		l.finish(&run, errInterrupted.Error(), "Interrupted")
+		l.interrupted = append(l.interrupted, run)
+	}
+}
+
+// Returns the runs found interrupted when the list was loaded.
+func (l *RunList) Interrupted() []Run {
+	return l.interrupted
+}
+
+// Returns the runs that were waiting in the queue when the server
+// stopped, oldest first.
+func (l *RunList) Queued() []Run {
+	var runs []Run
+	for _, e := range l.Dump() {
+		if run := e.(Run); run.Status == "Queued" {
+			runs = append(runs, run)
+		}
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].Queued.Before(runs[j].Queued) })
+	return runs
 }
 
 func (j *RunList) Len() int {
@@ -103,8 +212,15 @@ func (l *RunList) GetRecent(offset, length int) []elementer {
 	return runs
 }
 
-func (j *RunList) AddRun(UUID string, logRootPath string, job Job, tasks []Task) error {
-	run := Run{UUID: UUID, Job: job, Tasks: tasks, Start: time.Now(), Status: "New"}
+// Adds a run to the list, it will be executed once the Executor picks it
+// from its queue.
+func (j *RunList) AddRun(UUID string, job Job, tasks []Task, parameters map[string]string, event *Event) error {
+	return j.add(Run{UUID: UUID, Job: job, Tasks: tasks, Parameters: parameters, Event: event})
+}
+
+func (j *RunList) add(run Run) error {
+	now := time.Now()
+	run.Queued, run.Start, run.Status = now, now, "Queued"
 	// check to make sure that UUID doesn't already exist
 	var found bool = false
 	for _, j := range j.elements {
@@ -115,96 +231,349 @@ func (j *RunList) AddRun(UUID string, logRootPath string, job Job, tasks []Task)
 	if found {
 		return errors.New("Run with that name found in list")
 	}
+	if err := savePayload(j.notifier.settings, run); err != nil {
+		return err
+	}
 	j.Lock()
 	defer j.Unlock()
 
-	// add the run to the list and execute
 	j.elements = append(j.elements, run)
+	j.save()
+	return nil
+}
+
+// Registers a run as active, from now on it can be cancelled.
+func (l *RunList) track(UUID string) *execution {
+	ex := newExecution()
+	l.execLock.Lock()
+	l.executions[UUID] = ex
+	l.execLock.Unlock()
+	return ex
+}
+
+// Executes a tracked run, blocking until it is over.
+func (l *RunList) run(UUID string, logRootPath string, ex *execution) {
+	e, err := l.Get(UUID)
+	if err != nil {
+		l.execLock.Lock()
+		delete(l.executions, UUID)
+		l.execLock.Unlock()
+		log.Println("Cannot execute run:", err)
+		return
+	}
+	run := e.(Run)
 	logPath := filepath.Join(logRootPath, run.ID())
 	os.MkdirAll(logPath, os.ModePerm)
-	go j.execute(logPath, &run)
-	j.save()
+	l.execute(logPath, &run, ex)
+}
+
+// Marks a run that never left the queue as cancelled.
+func (l *RunList) cancelQueued(UUID string) error {
+	e, err := l.Get(UUID)
+	if err != nil {
+		return err
+	}
+	run := e.(Run)
+	l.finish(&run, errCancelled.Error(), "Cancelled")
+	return nil
+}
+
+// Stops a run: the process group of the task being executed is killed
+// and the remaining tasks are skipped.
+func (l *RunList) Cancel(UUID string) error {
+	l.execLock.Lock()
+	ex, ok := l.executions[UUID]
+	l.execLock.Unlock()
+	if !ok {
+		return fmt.Errorf("Run '%s' is not active", UUID)
+	}
+	ex.cancel()
 	return nil
 }
 
-func (l *RunList) execute(logPath string, r *Run) {
+func (l *RunList) execute(logPath string, r *Run, ex *execution) {
+	defer func() {
+		l.execLock.Lock()
+		delete(l.executions, r.UUID)
+		l.execLock.Unlock()
+	}()
+
+	if r.Job.Timeout > 0 {
+		timer := time.AfterFunc(time.Duration(r.Job.Timeout)*time.Second, func() { ex.timeout(nil) })
+		defer timer.Stop()
+	}
+
+	w := runWorkspace(l.notifier.settings, r)
+	if err := w.create(); err != nil {
+		log.Println("Cannot create workspace:", err)
+		l.finish(r, "Failed", "Failing")
+		return
+	}
+	defer os.RemoveAll(w.Tmp)
+	if err := l.seedWorkspace(r, w); err != nil {
+		log.Println("Cannot copy workspace of original run:", err)
+		l.finish(r, "Failed", "Failing")
+		return
+	}
+
+	r.Start = time.Now()
 	r.Status = "Running"
-	for _, task := range r.Tasks {
-		result := &Result{Start: time.Now(), LogPath: logPath, LogFileName: task.ID() + ".log", Task: task}
-		r.Results = append(r.Results, result)
-		l.Update(*r)
-		shell, commandArg := getShell()
-		cmd := exec.Command(shell, commandArg, task.Script)
-
-		cmd.Env = append(cmd.Env, "LIRICI_UUID="+r.UUID)
-		cmd.Env = append(cmd.Env, "LIRICI_JOB_NAME="+r.Job.ID())
-		cmd.Env = append(cmd.Env, "LIRICI_TASK_NAME="+task.Name)
-		cmd.Env = append(cmd.Env, "LIRICI_OUTPUT_DIR="+l.notifier.settings.Server.OutputPath)
-
-		outPipe, err := cmd.StdoutPipe()
-		if err != nil {
-			reportRunError(l, r, result, err)
-			return
+	r.Workspace = w.Dir
+	l.Update(*r)
+
+	deps, err := r.Job.dependencies()
+	if err != nil {
+		log.Println("Reporting error", err)
+		l.finish(r, "Failed", "Failing")
+		return
+	}
+
+	// Tasks running in parallel update the run and their results
+	// concurrently, the list only gets copies of the results so that they
+	// can be read while the tasks go on
+	var lock sync.Mutex
+	save := func(update func()) {
+		lock.Lock()
+		defer lock.Unlock()
+		update()
+		l.Update(r.snapshot())
+	}
+
+	type outcome struct {
+		position int
+		err      error
+	}
+	states := make([]int, len(r.Tasks))
+	for _, position := range r.Reused {
+		states[position] = taskSucceeded
+	}
+	outcomes := make(chan outcome)
+	active := 0
+	failure := false
+	warning := false
+	// A task that failed because it took too long times the run out
+	timedOut := false
+	for {
+		// Start or skip the pending tasks until nothing changes, once the
+		// run is stopped only the tasks that always run are started
+		stopped := ex.stopped() != nil
+		for changed := true; changed; {
+			changed = false
+			for i, task := range r.Tasks {
+				if states[i] != taskPending {
+					continue
+				}
+				switch schedule(r.Job.Tasks[i], states, deps[i], failure || stopped) {
+				case taskRunning:
+					states[i] = taskRunning
+					active++
+					go func(position int, task Task) {
+						always := r.Job.Tasks[position].AlwaysRun
+						outcomes <- outcome{position, l.runAttempts(logPath, r, task, always, ex, save)}
+					}(i, task)
+					changed = true
+				case taskSkipped:
+					states[i] = taskSkipped
+					changed = true
+				}
+			}
+		}
+		if active == 0 {
+			break
+		}
+
+		o := <-outcomes
+		active--
+		switch {
+		case o.err == nil:
+			states[o.position] = taskSucceeded
+		case r.Job.Tasks[o.position].AllowFailure:
+			states[o.position] = taskSucceeded
+			warning = true
+		default:
+			states[o.position] = taskFailed
+			failure = true
+			timedOut = timedOut || o.err == errTimedOut
+		}
+	}
+
+	switch reason := ex.stopped(); {
+	case reason == errCancelled:
+		l.finish(r, reason.Error(), "Cancelled")
+	case reason != nil:
+		l.finish(r, reason.Error(), "Failing")
+	case timedOut:
+		l.finish(r, errTimedOut.Error(), "Failing")
+	case failure:
+		l.finish(r, "Failed", "Failing")
+	case warning:
+		l.finish(r, "PassedWithWarnings", "Warning")
+	default:
+		l.finish(r, "Done", "Ok")
+	}
+}
+
+// States of the tasks of a run being executed.
+const (
+	taskPending = iota
+	taskRunning
+	taskSucceeded
+	taskFailed
+	taskSkipped
+)
+
+// Decides whether a pending task can start, must be skipped or has to wait.
+// Once a task failed or the run was stopped only the tasks that always run
+// are started, as soon as every task they need is over.
+func schedule(task JobTask, states []int, deps []int, failure bool) int {
+	over, succeeded := true, true
+	for _, dep := range deps {
+		switch states[dep] {
+		case taskPending, taskRunning:
+			over, succeeded = false, false
+		case taskFailed, taskSkipped:
+			succeeded = false
+		}
+	}
+	switch {
+	case task.AlwaysRun && over:
+		return taskRunning
+	case task.AlwaysRun:
+		return taskPending
+	case failure:
+		return taskSkipped
+	case succeeded:
+		return taskRunning
+	}
+	return taskPending
+}
+
+// Executes a task until it succeeds or its retry policy gives up, every
+// attempt gets its own result. The run and the results are only changed
+// through save.
+func (l *RunList) runAttempts(logPath string, r *Run, task Task, always bool, ex *execution, save func(func())) error {
+	for attempt := 1; ; attempt++ {
+		logFileName := task.ID() + logExtension
+		if attempt > 1 {
+			logFileName = fmt.Sprintf("%s.%d%s", task.ID(), attempt, logExtension)
+		}
+		result := &Result{Start: time.Now(), LogPath: logPath, LogFileName: logFileName, Task: task, Attempt: attempt}
+		save(func() { r.Results = append(r.Results, result) })
+
+		err := l.runTask(r, task, always, result, ex, save)
+		var artifacts []Artifact
+		if err == nil {
+			artifacts, err = collectArtifacts(l.notifier.settings, r, task)
 		}
-		errPipe, err := cmd.StderrPipe()
 		if err != nil {
-			outPipe.Close()
-			reportRunError(l, r, result, err)
-			return
+			log.Println("Reporting error", err)
+		}
+		save(func() {
+			result.End = time.Now()
+			if err != nil {
+				result.Error = err.Error()
+			}
+			r.addArtifacts(artifacts)
+		})
+		if err := l.index.add(r.UUID, result); err != nil {
+			log.Println("Cannot index log:", err)
 		}
-		var outputWg sync.WaitGroup
-		outputWg.Add(1)
-		go result.muxIntoOutput(outPipe, errPipe, &outputWg)
 
-		if err2 := cmd.Start(); err2 != nil {
-			reportRunError(l, r, result, err2)
-			return
+		if err == nil || ex.stopped() != nil || !task.retries(attempt, err) {
+			return err
 		}
-		outputWg.Wait()
-		if err2 := cmd.Wait(); err2 != nil {
-			reportRunError(l, r, result, err2)
-			return
+		delay := task.backoff(attempt)
+		log.Printf("Retrying task %s of run %s in %s\n", task.Name, r.UUID, delay)
+		if reason := ex.wait(delay); reason != nil {
+			return reason
 		}
-		result.End = time.Now()
+	}
+}
+
+// Executes the script of a task, blocking until it exits. A task that
+// always runs is started even when the run was stopped.
+func (l *RunList) runTask(r *Run, task Task, always bool, result *Result, ex *execution, save func(func())) error {
+	shell, commandArg := getShell()
+	cmd := exec.Command(shell, commandArg, task.Script)
+
+	secrets, err := l.secretList.reveal(r.Job.Secrets)
+	if err != nil {
+		return err
+	}
+	env := taskEnvironment(l.notifier.settings, r, task, secrets)
+	cmd.Env = envList(env)
+	cmd.Dir = r.Workspace
+	masks := secretMasks(secrets)
+	save(func() {
+		result.Env = redactEnv(env, secrets)
+		result.masks = masks
+	})
+
+	// The write ends are only closed here once the command started, or
+	// right away when the run was stopped before it could start
+	outPipe, outWriter, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	errPipe, errWriter, err := os.Pipe()
+	if err != nil {
+		outPipe.Close()
+		outWriter.Close()
+		return err
+	}
+	cmd.Stdout, cmd.Stderr = outWriter, errWriter
+	logWriter, err := newLogWriter(result, r.UUID, l.logs)
+	if err == nil {
+		err = ex.start(cmd, always)
 		if err != nil {
-			reportRunError(l, r, result, err)
-			return
+			logWriter.close()
 		}
-		l.Update(*r)
 	}
-	r.End = time.Now()
-	r.Status = "Done"
-	job, err := l.jobList.Get(r.Job.Name)
+	outWriter.Close()
+	errWriter.Close()
 	if err != nil {
-		return
+		outPipe.Close()
+		errPipe.Close()
+		return err
 	}
-	j := job.(Job)
-	j.Status = "Ok"
-	l.jobList.Update(job)
-	l.Update(*r)
-	l.notifier.Queue <- r
+	var outputWg sync.WaitGroup
+	outputWg.Add(1)
+	go result.muxIntoOutput(outPipe, errPipe, logWriter, &outputWg)
+	var timer *time.Timer
+	if task.Timeout > 0 {
+		timer = time.AfterFunc(time.Duration(task.Timeout)*time.Second, func() { ex.timeout(cmd) })
+	}
+	outputWg.Wait()
+	err = cmd.Wait()
+	if timer != nil {
+		timer.Stop()
+	}
+	reason := ex.finish(cmd)
+	if cmd.ProcessState != nil {
+		save(func() { result.setProcessState(cmd.ProcessState) })
+	}
+	if reason != nil {
+		return reason
+	}
+	return err
 }
 
-func (result *Result) muxIntoOutput(stdout io.ReadCloser, stderr io.ReadCloser, done *sync.WaitGroup) {
+func (result *Result) muxIntoOutput(stdout io.ReadCloser, stderr io.ReadCloser, writer *logWriter, done *sync.WaitGroup) {
 	defer done.Done()
-	file, err := os.Create(filepath.Join(result.LogPath, result.LogFileName))
-	if err != nil {
-		panic(err)
-	}
-	defer file.Close()
+	defer writer.close()
 	outLines := consumeLines(stdout)
 	errLines := consumeLines(stderr)
 	for outLines != nil || errLines != nil {
 		select {
 		case line, ok := <-outLines:
 			if ok {
-				file.WriteString(line + "\n")
+				writer.writeLine(Stdout, result.mask(line))
 			} else {
 				outLines = nil
 			}
 		case line, ok := <-errLines:
 			if ok {
-				file.WriteString(line + "\n")
+				writer.writeLine(Stderr, result.mask(line))
 			} else {
 				errLines = nil
 			}
@@ -212,6 +581,40 @@ func (result *Result) muxIntoOutput(stdout io.ReadCloser, stderr io.ReadCloser,
 	}
 }
 
+type byLength []string
+
+func (s byLength) Len() int           { return len(s) }
+func (s byLength) Less(i, j int) bool { return len(s[i]) < len(s[j]) }
+func (s byLength) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+
+// Returns the texts to hide from the log of a task given these secrets.
+// The log is masked line by line, so every line of a secret spanning
+// several lines is hidden on its own.
+func secretMasks(secrets map[string]string) []string {
+	seen := make(map[string]bool)
+	var masks []string
+	for _, value := range secrets {
+		for _, line := range strings.Split(value, "\n") {
+			line = strings.TrimSpace(line)
+			if line != "" && !seen[line] {
+				seen[line] = true
+				masks = append(masks, line)
+			}
+		}
+	}
+	// Longest first, so that a secret containing another is fully hidden
+	sort.Sort(sort.Reverse(byLength(masks)))
+	return masks
+}
+
+// Hides the values of the secrets given to the task.
+func (result *Result) mask(line string) string {
+	for _, secret := range result.masks {
+		line = strings.Replace(line, secret, redacted, -1)
+	}
+	return line
+}
+
 func consumeLines(reader io.ReadCloser) <-chan string {
 	lines := make(chan string)
 	go func() {
@@ -229,21 +632,37 @@ func consumeLines(reader io.ReadCloser) <-chan string {
 	return lines
 }
 
-func reportRunError(l *RunList, r *Run, result *Result, err error) {
-	log.Println("Reporting error", err)
-	result.Error = err.Error()
-	r.Status = "Failed"
+// Records the final status of a run and of its job, then notifies it.
+func (l *RunList) finish(r *Run, status string, jobStatus string) {
+	log.Println("Run", r.UUID, "finished:", status)
+	r.Status = status
 	r.End = time.Now()
 	l.Update(*r)
-	job, err := l.jobList.Get(r.Job.Name)
+	l.setJobStatus(r.Job.Name, jobStatus)
+	l.notifier.Queue <- r
+}
+
+func (l *RunList) setJobStatus(name string, status string) {
+	job, err := l.jobList.Get(name)
 	if err != nil {
 		return
 	}
 	j := job.(Job)
-	j.Status = "Failing"
-	l.jobList.Update(job)
-	l.notifier.Queue <- r
-	return
+	j.Status = status
+	l.jobList.Update(j)
+}
+
+// Returns the exit code of a process that ran to completion.
+func exitCode(err error) (int, bool) {
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return 0, false
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok || !status.Exited() {
+		return 0, false
+	}
+	return status.ExitStatus(), true
 }
 
 func getShell() (string, string) {
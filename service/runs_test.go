@@ -0,0 +1,159 @@
+package service
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSchedule(t *testing.T) {
+	states := []int{taskSucceeded, taskFailed, taskRunning}
+	cases := []struct {
+		task     JobTask
+		deps     []int
+		failure  bool
+		expected int
+	}{
+		{JobTask{Name: "next"}, []int{0}, false, taskRunning},
+		{JobTask{Name: "waiting"}, []int{0, 2}, false, taskPending},
+		{JobTask{Name: "after failure"}, []int{0}, true, taskSkipped},
+		{JobTask{Name: "cleanup", AlwaysRun: true}, []int{0, 1}, true, taskRunning},
+		{JobTask{Name: "cleanup", AlwaysRun: true}, []int{1, 2}, true, taskPending},
+	}
+	for _, c := range cases {
+		if state := schedule(c.task, states, c.deps, c.failure); state != c.expected {
+			t.Errorf("Task '%s' expected state %d but got %d", c.task.Name, c.expected, state)
+		}
+	}
+}
+
+func TestRecover(t *testing.T) {
+	root, err := ioutil.TempDir("", "runs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	ioutil.WriteFile(filepath.Join(root, runsFile), []byte(`[
+		{"uuid": "running", "job": {"name": "job"}, "status": "Running", "results": [{"logfilename": "t.jsonl"}]},
+		{"uuid": "queued", "job": {"name": "job"}, "status": "Queued"},
+		{"uuid": "done", "job": {"name": "job"}, "status": "Done"}
+	]`), 0644)
+
+	var settings Settings
+	notifier := NewNotifier(&settings)
+	go notifier.NotifierLoop()
+	jobList := NewJobList(root)
+	jobList.Append(Job{Name: "job", Status: "Ok"})
+	runList := NewRunList(root, notifier, jobList, nil)
+	runList.Load()
+
+	interrupted := runList.Interrupted()
+	if len(interrupted) != 1 || interrupted[0].UUID != "running" {
+		t.Fatalf("Unexpected interrupted runs %v", interrupted)
+	}
+	e, _ := runList.Get("running")
+	run := e.(Run)
+	if run.Status != "Interrupted" || run.End.IsZero() || run.Results[0].Error != "Interrupted" || run.Results[0].End.IsZero() {
+		t.Errorf("Run not marked as interrupted: %v", run)
+	}
+	if job, _ := jobList.Get("job"); job.(Job).Status != "Interrupted" {
+		t.Errorf("Unexpected job status %s", job.(Job).Status)
+	}
+	if queued := runList.Queued(); len(queued) != 1 || queued[0].UUID != "queued" {
+		t.Errorf("Unexpected queued runs %v", queued)
+	}
+}
+
+func TestSetProcessState(t *testing.T) {
+	cases := []struct {
+		script string
+		code   int
+		signal string
+	}{
+		{"exit 3", 3, ""},
+		{"kill -TERM $$", -1, "terminated"},
+	}
+	for _, c := range cases {
+		cmd := exec.Command("sh", "-c", c.script)
+		cmd.Run()
+		var result Result
+		result.setProcessState(cmd.ProcessState)
+		if result.ExitCode == nil || *result.ExitCode != c.code || result.Signal != c.signal {
+			t.Errorf("'%s': expected exit code %d and signal '%s', got %v and '%s'", c.script, c.code, c.signal, result.ExitCode, result.Signal)
+		}
+		if result.MaxRSS <= 0 {
+			t.Errorf("'%s': expected the peak memory to be recorded", c.script)
+		}
+	}
+
+	// A task that never started has no exit code
+	bytes, _ := json.Marshal(Result{})
+	if strings.Contains(string(bytes), "exit_code") {
+		t.Errorf("Unexpected exit code in %s", bytes)
+	}
+}
+
+func TestMask(t *testing.T) {
+	result := Result{masks: secretMasks(map[string]string{
+		"TOKEN":  "abc",
+		"LONGER": "abcdef",
+		"KEY":    "-----BEGIN KEY-----\r\n  line one\n\nline two\n-----END KEY-----\n",
+	})}
+	cases := map[string]string{
+		"token abc":               "token " + redacted,
+		"longer abcdefg":          "longer " + redacted + "g",
+		"-----BEGIN KEY-----":     redacted,
+		"    line one":            "    " + redacted,
+		"line two, line three":    redacted + ", line three",
+		"nothing secret":          "nothing secret",
+		"the key ends with abc-x": "the key ends with " + redacted + "-x",
+	}
+	for line, expected := range cases {
+		if masked := result.mask(line); masked != expected {
+			t.Errorf("Expected '%s' to be masked as '%s', got '%s'", line, expected, masked)
+		}
+	}
+}
+
+func TestMuxIntoOutput(t *testing.T) {
+	logPath, err := ioutil.TempDir("", "logs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(logPath)
+	result := &Result{LogPath: logPath, LogFileName: "task" + logExtension,
+		masks: secretMasks(map[string]string{"SHORT": "pass", "LONG": "password", "CERT": "first\nsecond"})}
+	events := make(chan logEvent, 16)
+	writer, err := newLogWriter(result, "run", events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	result.muxIntoOutput(ioutil.NopCloser(strings.NewReader("password is pass\nfirst\n")),
+		ioutil.NopCloser(strings.NewReader("second line\n")), writer, &wg)
+	wg.Wait()
+
+	lines, err := readLogLines(filepath.Join(logPath, result.LogFileName), 0, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	masked := make(map[string]string)
+	for _, line := range lines {
+		masked[line.Line] = line.Stream
+	}
+	expected := map[string]string{
+		redacted + " is " + redacted: Stdout,
+		redacted:                     Stdout,
+		redacted + " line":           Stderr,
+	}
+	if !reflect.DeepEqual(masked, expected) {
+		t.Errorf("Expected lines %v, got %v", expected, masked)
+	}
+}
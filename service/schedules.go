@@ -0,0 +1,106 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	cronService "gopkg.in/robfig/cron.v2"
+)
+
+// Most times returned by a preview or a calendar.
+const maxFirings = 1000
+
+// A job started by a trigger at a given time.
+type Firing struct {
+	Time    time.Time `json:"time"`
+	Trigger string    `json:"trigger"`
+	Job     string    `json:"job"`
+}
+
+// Parses a cron expression, optionally prefixed by a TZ=<location> time
+// zone, returning the parse error instead of panicking.
+func ParseSchedule(expression string) (cronService.Schedule, error) {
+	expression = strings.TrimSpace(expression)
+	if expression == "" {
+		return nil, errors.New("Empty schedule")
+	}
+	if strings.HasPrefix(expression, "TZ=") && !strings.Contains(expression, " ") {
+		return nil, errors.New("Missing schedule after the time zone")
+	}
+	return cronService.Parse(expression)
+}
+
+// Returns the next count times of a schedule after a time, fewer when the
+// schedule stops firing.
+func nextTimes(schedule cronService.Schedule, after time.Time, count int) []time.Time {
+	if count > maxFirings {
+		count = maxFirings
+	}
+	times := []time.Time{}
+	for t := after; len(times) < count; {
+		t = schedule.Next(t)
+		if t.IsZero() {
+			break
+		}
+		times = append(times, t)
+	}
+	return times
+}
+
+// Returns the next count times an expression fires after a time.
+func UpcomingTimes(expression string, after time.Time, count int) ([]time.Time, error) {
+	schedule, err := ParseSchedule(expression)
+	if err != nil {
+		return nil, err
+	}
+	return nextTimes(schedule, after, count), nil
+}
+
+// Returns the next count times an armed trigger fires.
+func (e *Executor) NextFires(name string, count int) ([]time.Time, error) {
+	e.entriesLock.Lock()
+	id, ok := e.entries[name]
+	e.entriesLock.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("Trigger '%s' is not armed", name)
+	}
+	return nextTimes(e.cron.Entry(id).Schedule, time.Now(), count), nil
+}
+
+// Returns the jobs the armed triggers start between two times, in order.
+func (e *Executor) Calendar(from, to time.Time) []Firing {
+	e.entriesLock.Lock()
+	schedules := make(map[string]cronService.Schedule)
+	for name, id := range e.entries {
+		schedules[name] = e.cron.Entry(id).Schedule
+	}
+	e.entriesLock.Unlock()
+
+	firings := []Firing{}
+	for name, schedule := range schedules {
+		jobs := e.jobList.GetJobsWithTrigger(name)
+		n := 0
+		for t := schedule.Next(from); !t.IsZero() && t.Before(to) && n < maxFirings; t = schedule.Next(t) {
+			n++
+			for _, job := range jobs {
+				firings = append(firings, Firing{Time: t, Trigger: name, Job: job.Name})
+			}
+		}
+	}
+	sort.Slice(firings, func(i, j int) bool {
+		if !firings[i].Time.Equal(firings[j].Time) {
+			return firings[i].Time.Before(firings[j].Time)
+		}
+		if firings[i].Trigger != firings[j].Trigger {
+			return firings[i].Trigger < firings[j].Trigger
+		}
+		return firings[i].Job < firings[j].Job
+	})
+	if len(firings) > maxFirings {
+		firings = firings[:maxFirings]
+	}
+	return firings
+}
@@ -0,0 +1,69 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	cronService "gopkg.in/robfig/cron.v2"
+)
+
+func TestUpcomingTimes(t *testing.T) {
+	after := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	times, err := UpcomingTimes("TZ=Europe/Rome 0 0 2 * * *", after, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(times) != 2 || !times[0].Equal(time.Date(2024, 3, 2, 1, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected times %v", times)
+	}
+
+	for _, expression := range []string{"", "TZ=Europe/Rome", "TZ=Nowhere/Town 0 0 * * *", "0 0 *"} {
+		if _, err := UpcomingTimes(expression, after, 1); err == nil {
+			t.Errorf("Expected '%s' to be invalid", expression)
+		}
+	}
+}
+
+func TestCalendar(t *testing.T) {
+	triggerList := NewTriggerList("")
+	triggerList.elements = []elementer{
+		Trigger{Name: "nightly", Schedule: "TZ=UTC 0 0 2 * * *"},
+		Trigger{Name: "noon", Schedule: "TZ=UTC 0 0 12 * * *"},
+	}
+	jobList := NewJobList("")
+	jobList.elements = []elementer{
+		Job{Name: "build", Triggers: []string{"nightly", "noon"}},
+		Job{Name: "docs", Triggers: []string{"nightly"}},
+	}
+	e := &Executor{
+		cron:        cronService.New(),
+		jobList:     jobList,
+		triggerList: triggerList,
+		entries:     make(map[string]cronService.EntryID),
+		armed:       make(map[string]Trigger),
+	}
+	e.Reconcile()
+
+	from := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	firings := e.Calendar(from, from.AddDate(0, 0, 1))
+	expected := []Firing{
+		{from.Add(2 * time.Hour), "nightly", "build"},
+		{from.Add(2 * time.Hour), "nightly", "docs"},
+		{from.Add(12 * time.Hour), "noon", "build"},
+	}
+	if len(firings) != len(expected) {
+		t.Fatalf("Expected %d firings, got %v", len(expected), firings)
+	}
+	for i := range expected {
+		if !firings[i].Time.Equal(expected[i].Time) || firings[i].Trigger != expected[i].Trigger || firings[i].Job != expected[i].Job {
+			t.Errorf("Expected %v, got %v", expected[i], firings[i])
+		}
+	}
+
+	if _, err := e.NextFires("weekly", 1); err == nil {
+		t.Error("Trigger that is not armed should have no next fire")
+	}
+	if times, _ := e.NextFires("noon", 3); len(times) != 3 {
+		t.Errorf("Expected 3 times, got %v", times)
+	}
+}
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+)
+
+// A secret as stored on disk, the value is encrypted.
+type Secret struct {
+	Name    string    `json:"name"`
+	Value   string    `json:"value"`
+	Updated time.Time `json:"updated"`
+}
+
+func (s Secret) ID() string {
+	return s.Name
+}
+
+// What the API tells about a secret, the value is never returned.
+type SecretInfo struct {
+	Name    string    `json:"name"`
+	Updated time.Time `json:"updated"`
+}
+
+type SecretList struct {
+	list
+	aead cipher.AEAD
+}
+
+// Creates the list of secrets, encrypted with AES-GCM using a key derived
+// from the given passphrase. Secrets cannot be used when it is empty.
+func NewSecretList(rootPath string, passphrase string) *SecretList {
+	l := &SecretList{
+		list: list{elements: []elementer{}, fileName: filepath.Join(rootPath, secretsFile)},
+	}
+	if passphrase != "" {
+		key := sha256.Sum256([]byte(passphrase))
+		block, err := aes.NewCipher(key[:])
+		if err != nil {
+			panic(err)
+		}
+		l.aead, err = cipher.NewGCM(block)
+		if err != nil {
+			panic(err)
+		}
+	}
+	return l
+}
+
+func (l *SecretList) Load() {
+	bytes := readFile(l.fileName)
+	var secrets []Secret
+	err := json.Unmarshal([]byte(string(bytes)), &secrets)
+	if err != nil {
+		panic(err)
+	}
+	l.elements = []elementer{}
+	for _, secret := range secrets {
+		l.elements = append(l.elements, secret)
+	}
+}
+
+func (l *SecretList) Info() []SecretInfo {
+	l.RLock()
+	defer l.RUnlock()
+
+	infos := make([]SecretInfo, 0, len(l.elements))
+	for _, e := range l.elements {
+		secret := e.(Secret)
+		infos = append(infos, SecretInfo{secret.Name, secret.Updated})
+	}
+	return infos
+}
+
+// Encrypts and stores a secret, replacing the previous value if any.
+func (l *SecretList) Set(name string, value string) error {
+	if l.aead == nil {
+		return errors.New("No secrets key configured")
+	}
+	if !identifier.MatchString(name) {
+		return fmt.Errorf("Invalid secret name '%s'", name)
+	}
+
+	nonce := make([]byte, l.aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+	sealed := l.aead.Seal(nonce, nonce, []byte(value), []byte(name))
+	secret := Secret{Name: name, Value: base64.StdEncoding.EncodeToString(sealed), Updated: time.Now()}
+
+	if _, err := l.Get(name); err == nil {
+		return l.Update(secret)
+	}
+	return l.Append(secret)
+}
+
+// Returns the decrypted value of a secret.
+func (l *SecretList) Reveal(name string) (string, error) {
+	if l.aead == nil {
+		return "", errors.New("No secrets key configured")
+	}
+	e, err := l.Get(name)
+	if err != nil {
+		return "", err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(e.(Secret).Value)
+	if err != nil {
+		return "", err
+	}
+	size := l.aead.NonceSize()
+	if len(sealed) < size {
+		return "", fmt.Errorf("Secret '%s' is corrupted", name)
+	}
+	value, err := l.aead.Open(nil, sealed[:size], sealed[size:], []byte(name))
+	if err != nil {
+		return "", fmt.Errorf("Cannot decrypt secret '%s': %v", name, err)
+	}
+	return string(value), nil
+}
+
+// Returns the values of the given secrets, by name.
+func (l *SecretList) reveal(names []string) (map[string]string, error) {
+	values := make(map[string]string)
+	for _, name := range names {
+		value, err := l.Reveal(name)
+		if err != nil {
+			return nil, err
+		}
+		values[name] = value
+	}
+	return values, nil
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	secrets := NewSecretList(dir, "passphrase")
+	secrets.Load()
+	if err := secrets.Set("API_TOKEN", "s3cr3t"); err != nil {
+		t.Fatal(err)
+	}
+	bytes, err := ioutil.ReadFile(secrets.fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(bytes), "s3cr3t") {
+		t.Error("Secret is stored in plain text")
+	}
+
+	secrets = NewSecretList(dir, "passphrase")
+	secrets.Load()
+	if value, err := secrets.Reveal("API_TOKEN"); err != nil || value != "s3cr3t" {
+		t.Errorf("Expected s3cr3t but got %s, %v", value, err)
+	}
+
+	secrets = NewSecretList(dir, "other")
+	secrets.Load()
+	if _, err := secrets.Reveal("API_TOKEN"); err == nil {
+		t.Error("Secret decrypted with the wrong key")
+	}
+}
@@ -8,6 +8,31 @@ type Settings struct {
 		DbRootPath string
 		OutputPath string
 	}
+	Executor struct {
+		MaxConcurrentRuns int
+	}
+	Retention struct {
+		// Number of runs kept for each job
+		KeepRuns int
+		// Days during which finished runs are kept
+		KeepDays int
+	}
+	Workspace struct {
+		// Directory holding the workspaces, "workspaces" under DbRootPath by default
+		Path string
+		// Days after which the workspaces of finished runs are removed
+		RetentionDays int
+	}
+	Environment struct {
+		// Names of the server variables passed on to the tasks
+		Inherit []string
+		// Variables set for every task, as NAME=value
+		Variable []string
+	}
+	Secrets struct {
+		// Passphrase the secrets are encrypted with
+		Key string
+	}
 	Slack struct {
 		Enabled    bool
 		WebHookURL string
@@ -3,17 +3,67 @@ package service
 import (
 	"encoding/json"
 	"path/filepath"
+	"time"
 )
 
+// How a failed task is attempted again.
+type Retry struct {
+	// Total number of attempts, including the first one
+	MaxAttempts int `json:"max_attempts"`
+	// Seconds to wait before the second attempt, doubled for each further one
+	Backoff int `json:"backoff"`
+	// Only retry when the script exits with one of these codes, any failure
+	// is retried when empty
+	ExitCodes []int `json:"exit_codes,omitempty"`
+}
+
 type Task struct {
 	Name   string `json:"name"`
 	Script string `json:"script"`
+	// Number of the current revision, see RevisionList
+	Revision int `json:"revision,omitempty"`
+	// Seconds after which the task is terminated, no limit when 0
+	Timeout int    `json:"timeout,omitempty"`
+	Retry   *Retry `json:"retry,omitempty"`
+	// Variables set for the task, they override the job ones
+	Env map[string]string `json:"env,omitempty"`
+	// Glob patterns of the files kept after the task succeeded, relative
+	// to the workspace
+	Artifacts []string `json:"artifacts,omitempty"`
 }
 
 func (t Task) ID() string {
 	return t.Name
 }
 
+// Tells whether the given failed attempt should be followed by another one.
+func (t Task) retries(attempt int, err error) bool {
+	if t.Retry == nil || attempt >= t.Retry.MaxAttempts {
+		return false
+	}
+	if len(t.Retry.ExitCodes) == 0 {
+		return true
+	}
+	code, ok := exitCode(err)
+	if !ok {
+		return false
+	}
+	for _, c := range t.Retry.ExitCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns how long to wait after the given failed attempt.
+func (t Task) backoff(attempt int) time.Duration {
+	if t.Retry == nil {
+		return 0
+	}
+	return time.Duration(t.Retry.Backoff) * time.Second << uint(attempt-1)
+}
+
 type TaskList struct {
 	list
 }
@@ -1,7 +1,9 @@
 package service
 
 import (
+	"os/exec"
 	"testing"
+	"time"
 )
 
 func TestTaskID(t *testing.T) {
@@ -10,3 +12,29 @@ func TestTaskID(t *testing.T) {
 		t.Errorf("ID() expected %s but got %s", "Task", task.ID())
 	}
 }
+
+func TestTaskRetries(t *testing.T) {
+	err := exec.Command("/bin/sh", "-c", "exit 3").Run()
+
+	task := Task{Name: "Task"}
+	if task.retries(1, err) {
+		t.Error("Task without retry policy should not be retried")
+	}
+
+	task.Retry = &Retry{MaxAttempts: 3, Backoff: 2}
+	if !task.retries(1, err) || !task.retries(2, err) || task.retries(3, err) {
+		t.Error("Task should be attempted 3 times")
+	}
+	if task.backoff(1) != 2*time.Second || task.backoff(2) != 4*time.Second {
+		t.Errorf("Unexpected backoff %s, %s", task.backoff(1), task.backoff(2))
+	}
+
+	task.Retry.ExitCodes = []int{1, 2}
+	if task.retries(1, err) {
+		t.Error("Exit code 3 should not be retried")
+	}
+	task.Retry.ExitCodes = []int{3}
+	if !task.retries(1, err) {
+		t.Error("Exit code 3 should be retried")
+	}
+}
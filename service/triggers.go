@@ -2,18 +2,68 @@ package service
 
 import (
 	"encoding/json"
+	"fmt"
 	"path/filepath"
 )
 
+// Kinds of triggers.
+const (
+	// Fires on a cron schedule, the default
+	CronTrigger = "cron"
+	// Fires when a signed request is posted to /hooks/{trigger}
+	WebhookTrigger = "webhook"
+	// Fires when a branch of a local git repository moves
+	PollTrigger = "poll"
+)
+
 type Trigger struct {
-	Name     string `json:"name"`
+	Name string `json:"name"`
+	// CronTrigger when empty
+	Type     string `json:"type,omitempty"`
 	Schedule string `json:"schedule"`
+	// Name of the secret signing the requests of a webhook trigger
+	Secret string `json:"secret,omitempty"`
+	// Filters of the forge events firing a webhook trigger, see Matches
+	Events   []string `json:"events,omitempty"`
+	Branches []string `json:"branches,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	Paths    []string `json:"paths,omitempty"`
+	// Repository watched by a polling trigger, a path or a file:// URL,
+	// and the seconds between two polls
+	Repository string `json:"repository,omitempty"`
+	Interval   int    `json:"interval,omitempty"`
+	// Values given to the parameters of the jobs started by the trigger
+	Parameters map[string]string `json:"parameters,omitempty"`
 }
 
 func (t Trigger) ID() string {
 	return t.Name
 }
 
+// Returns the cron expression of the trigger, empty when it doesn't fire
+// on a schedule.
+func (t Trigger) spec() string {
+	switch t.Type {
+	case "", CronTrigger:
+		return t.Schedule
+	case PollTrigger:
+		interval := t.Interval
+		if interval <= 0 {
+			interval = defaultPollInterval
+		}
+		return fmt.Sprintf("@every %ds", interval)
+	}
+	return ""
+}
+
+func ValidateTriggerType(kind string) error {
+	switch kind {
+	case "", CronTrigger, WebhookTrigger, PollTrigger:
+		return nil
+	}
+	return fmt.Errorf("Unknown trigger type '%s'", kind)
+}
+
 type TriggerList struct {
 	list
 }
@@ -2,6 +2,8 @@ package service
 
 import (
 	"testing"
+
+	cronService "gopkg.in/robfig/cron.v2"
 )
 
 func TestTriggerID(t *testing.T) {
@@ -10,3 +12,50 @@ func TestTriggerID(t *testing.T) {
 		t.Errorf("ID() expected %s but got %s", "Triggy", trigger.ID())
 	}
 }
+
+func TestReconcileTriggers(t *testing.T) {
+	triggerList := NewTriggerList("")
+	triggerList.elements = []elementer{
+		Trigger{Name: "nightly", Schedule: "0 0 2 * * *"},
+		Trigger{Name: "hourly", Schedule: "0 0 * * * *"},
+	}
+	jobList := NewJobList("")
+	jobList.elements = []elementer{Job{Name: "ci", Triggers: []string{"nightly"}}}
+	e := &Executor{
+		cron:        cronService.New(),
+		jobList:     jobList,
+		triggerList: triggerList,
+		entries:     make(map[string]cronService.EntryID),
+		armed:       make(map[string]Trigger),
+	}
+
+	e.Reconcile()
+	e.Reconcile()
+	if len(e.cron.Entries()) != 1 || e.entries["nightly"] == 0 {
+		t.Fatalf("Only nightly should be armed once, got %v", e.entries)
+	}
+
+	// A new schedule replaces the entry
+	triggerList.elements[0] = Trigger{Name: "nightly", Schedule: "0 0 3 * * *"}
+	e.Reconcile()
+	if len(e.cron.Entries()) != 1 || e.armed["nightly"].Schedule != "0 0 3 * * *" {
+		t.Errorf("Expected one entry with the new schedule, got %v", e.armed)
+	}
+
+	jobList.elements[0] = Job{Name: "ci", Triggers: []string{"hourly"}}
+	e.Reconcile()
+	armed := e.ArmedTriggers()
+	if len(e.cron.Entries()) != 1 || len(armed) != 1 || armed[0].Trigger != "hourly" {
+		t.Errorf("Only hourly should be armed, got %v", armed)
+	}
+
+	// A new type with the same schedule replaces the entry too
+	triggerList.elements[1] = Trigger{Name: "hourly", Schedule: "@every 60s"}
+	e.Reconcile()
+	entry := e.entries["hourly"]
+	triggerList.elements[1] = Trigger{Name: "hourly", Type: PollTrigger, Repository: "/srv/git/project.git", Interval: 60}
+	e.Reconcile()
+	if len(e.cron.Entries()) != 1 || e.entries["hourly"] == entry || e.armed["hourly"].Type != PollTrigger {
+		t.Errorf("Expected the entry to poll, got %v", e.armed)
+	}
+}
@@ -0,0 +1,129 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Header carrying the HMAC-SHA256 of the body of a webhook request, as
+// "sha256=<hex>".
+const SignatureHeader = "X-Hub-Signature-256"
+
+// Largest webhook payload accepted, in bytes.
+const MaxPayloadSize = 5 << 20
+
+// What fired the trigger that started a run.
+type Event struct {
+	Trigger  string    `json:"trigger"`
+	Received time.Time `json:"received"`
+	// Size of the body of the webhook request, each run started by the
+	// request keeps it in the file given by PayloadPath
+	PayloadSize int `json:"payload_size,omitempty"`
+	// Body of the request, only until the runs are added
+	payload []byte
+	// PushEvent, TagEvent or PullRequestEvent, empty when the request
+	// doesn't come from a forge
+	Kind string `json:"kind,omitempty"`
+	Ref  string `json:"ref,omitempty"`
+	// Commit to build, and the previous head of the branch for pushes
+	SHA    string `json:"sha,omitempty"`
+	Before string `json:"before,omitempty"`
+	// Branch pushed to, or base branch of a pull request
+	Branch      string `json:"branch,omitempty"`
+	Tag         string `json:"tag,omitempty"`
+	PullRequest int    `json:"pull_request,omitempty"`
+	// Files changed by a push
+	Files []string `json:"files,omitempty"`
+}
+
+// Returns the file keeping the body of the webhook request that started
+// a run, next to its logs.
+func PayloadPath(settings *Settings, UUID string) string {
+	return filepath.Join(settings.Server.OutputPath, "files", "logs", UUID, "payload")
+}
+
+// Writes the payload of the event that started a run to its file.
+func savePayload(settings *Settings, r Run) error {
+	if r.Event == nil || r.Event.payload == nil {
+		return nil
+	}
+	path := PayloadPath(settings, r.UUID)
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, r.Event.payload, 0644)
+}
+
+// Returns a copy of the event of a run with the payload the run kept, so
+// that a run started again from it, such as a rerun, gets its own copy.
+func eventOf(settings *Settings, r Run) (*Event, error) {
+	if r.Event == nil || r.Event.PayloadSize == 0 {
+		return r.Event, nil
+	}
+	event := *r.Event
+	payload, err := ioutil.ReadFile(PayloadPath(settings, r.UUID))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	event.payload = payload
+	return &event, nil
+}
+
+// Returns the LIRICI_* variables describing the event.
+func (e *Event) env() map[string]string {
+	env := make(map[string]string)
+	if e == nil {
+		return env
+	}
+	for name, value := range map[string]string{
+		"LIRICI_TRIGGER":    e.Trigger,
+		"LIRICI_EVENT":      e.Kind,
+		"LIRICI_REF":        e.Ref,
+		"LIRICI_COMMIT_SHA": e.SHA,
+		"LIRICI_BEFORE_SHA": e.Before,
+		"LIRICI_BRANCH":     e.Branch,
+		"LIRICI_TAG":        e.Tag,
+	} {
+		if value != "" {
+			env[name] = value
+		}
+	}
+	if e.PullRequest != 0 {
+		env["LIRICI_PR_NUMBER"] = strconv.Itoa(e.PullRequest)
+	}
+	return env
+}
+
+// Checks the signature of a webhook payload against a secret.
+func VerifySignature(secret string, payload []byte, signature string) error {
+	if secret == "" {
+		return errors.New("Webhook has no secret")
+	}
+	if signature == "" {
+		return errors.New("Missing signature")
+	}
+	sum, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return errors.New("Invalid signature")
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	if !hmac.Equal(sum, mac.Sum(nil)) {
+		return errors.New("Signature mismatch")
+	}
+	return nil
+}
+
+// Starts the jobs attached to a webhook trigger, with the event recorded
+// on their runs, and returns the UUIDs of the runs.
+func (e *Executor) Hook(t Trigger, event *Event) []string {
+	return e.findAndRun(t.Name, event)
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestVerifySignature(t *testing.T) {
+	payload := []byte(`{"ref":"refs/heads/main"}`)
+	// echo -n '{"ref":"refs/heads/main"}' | openssl dgst -sha256 -hmac secret
+	signature := "sha256=d8f89f0618acd61fe621aa4e64078c0e2bca15d0b578b7f3eb734f55883c5320"
+
+	if err := VerifySignature("secret", payload, signature); err != nil {
+		t.Errorf("Expected a valid signature, got %v", err)
+	}
+	for _, c := range []struct{ secret, signature string }{
+		{"other", signature},
+		{"", signature},
+		{"secret", ""},
+		{"secret", "sha256=zz"},
+	} {
+		if err := VerifySignature(c.secret, payload, c.signature); err == nil {
+			t.Errorf("Expected signature '%s' with secret '%s' to be refused", c.signature, c.secret)
+		}
+	}
+}
+
+func TestSavePayload(t *testing.T) {
+	l, cleanup := newTestRunList(t)
+	defer cleanup()
+	settings := l.notifier.settings
+
+	event, err := ParseEvent("hook", http.Header{}, []byte(`{"hello": "world"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.AddRun("run", Job{Name: "job"}, nil, nil, event); err != nil {
+		t.Fatal(err)
+	}
+	e, _ := l.Get("run")
+	run := e.(Run)
+	run.End = time.Now()
+	if bytes, _ := json.Marshal(run); strings.Contains(string(bytes), "hello") {
+		t.Errorf("Payload stored with the run: %s", bytes)
+	}
+	if run.Event.PayloadSize != 18 {
+		t.Errorf("Unexpected payload size %d", run.Event.PayloadSize)
+	}
+	// As read back from the runs file
+	loaded := *run.Event
+	loaded.payload = nil
+	run.Event = &loaded
+
+	// A rerun gets its own copy, which outlives the original run
+	if err := l.AddRerun("rerun", run, false); err != nil {
+		t.Fatal(err)
+	}
+
+	// So does a run requeued after it was interrupted
+	run.Job.RequeueInterrupted = true
+	l.interrupted = []Run{run}
+	executor := &Executor{settings: settings, runList: l}
+	executor.queueCond = sync.NewCond(&executor.queueLock)
+	executor.resume()
+	requeued := executor.queue[len(executor.queue)-1]
+
+	for _, UUID := range []string{"run", "rerun", requeued} {
+		payload, err := ioutil.ReadFile(PayloadPath(settings, UUID))
+		if err != nil || string(payload) != `{"hello": "world"}` {
+			t.Errorf("Unexpected payload of %s: %s %v", UUID, payload, err)
+		}
+	}
+}
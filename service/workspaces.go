@@ -0,0 +1,112 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+)
+
+// Kinds of job workspaces.
+const (
+	// A new workspace for every run, removed by the retention policy
+	FreshWorkspace = "fresh"
+	// The same workspace for every run of the job, never removed
+	PersistentWorkspace = "persistent"
+)
+
+// Directories given to the tasks of a run, the workspace is also their
+// working directory.
+type workspace struct {
+	Dir  string
+	Home string
+	Tmp  string
+}
+
+var unsafeChars = regexp.MustCompile("[^A-Za-z0-9._-]")
+
+// Returns the absolute path of the workspaces, so that tasks changing
+// directory still find their home and temporary directories.
+func workspacesPath(settings *Settings) string {
+	path := settings.Workspace.Path
+	if path == "" {
+		path = filepath.Join(settings.Server.DbRootPath, "workspaces")
+	}
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
+
+// Returns the directories of a run:
+//
+//	<path>/runs/<uuid>/workspace  fresh workspace
+//	<path>/runs/<uuid>/home
+//	<path>/runs/<uuid>/tmp        removed at the end of the run
+//	<path>/jobs/<job>-<hash>      persistent workspace
+//
+// The name of the job is made safe for a path and followed by the start
+// of its SHA-256, so that jobs whose names only differ by unsafe
+// characters get their own persistent workspace.
+func runWorkspace(settings *Settings, r *Run) workspace {
+	root := workspacesPath(settings)
+	runPath := filepath.Join(root, "runs", r.UUID)
+	w := workspace{
+		Dir:  filepath.Join(runPath, "workspace"),
+		Home: filepath.Join(runPath, "home"),
+		Tmp:  filepath.Join(runPath, "tmp"),
+	}
+	if r.Job.Workspace == PersistentWorkspace {
+		sum := sha256.Sum256([]byte(r.Job.Name))
+		name := unsafeChars.ReplaceAllString(r.Job.Name, "_") + "-" + hex.EncodeToString(sum[:4])
+		w.Dir = filepath.Join(root, "jobs", name)
+	}
+	return w
+}
+
+func (w workspace) create() error {
+	for _, dir := range []string{w.Dir, w.Home, w.Tmp} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Removes the directories of the runs that ended more than
+// [Workspace] RetentionDays ago, persistent workspaces are kept.
+func pruneWorkspaces(settings *Settings, runList *RunList) {
+	if settings.Workspace.RetentionDays <= 0 {
+		return
+	}
+	limit := time.Now().AddDate(0, 0, -settings.Workspace.RetentionDays)
+	root := filepath.Join(workspacesPath(settings), "runs")
+	infos, err := ioutil.ReadDir(root)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Println("Cannot list workspaces:", err)
+		}
+		return
+	}
+	for _, info := range infos {
+		end := info.ModTime()
+		if e, err := runList.Get(info.Name()); err == nil {
+			end = e.(Run).End
+			if end.IsZero() {
+				// Still queued or running
+				continue
+			}
+		}
+		if end.After(limit) {
+			continue
+		}
+		log.Println("Removing workspace of run", info.Name())
+		if err := os.RemoveAll(filepath.Join(root, info.Name())); err != nil {
+			log.Println("Cannot remove workspace:", err)
+		}
+	}
+}
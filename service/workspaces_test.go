@@ -0,0 +1,34 @@
+package service
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestRunWorkspace(t *testing.T) {
+	var settings Settings
+	settings.Server.DbRootPath = "db"
+
+	root, _ := filepath.Abs(filepath.Join("db", "workspaces"))
+	run := &Run{UUID: "uuid", Job: Job{Name: "my job/1"}}
+	w := runWorkspace(&settings, run)
+	if w.Dir != filepath.Join(root, "runs", "uuid", "workspace") {
+		t.Errorf("Unexpected fresh workspace %s", w.Dir)
+	}
+	if w.Tmp != filepath.Join(root, "runs", "uuid", "tmp") {
+		t.Errorf("Unexpected temporary directory %s", w.Tmp)
+	}
+
+	run.Job.Workspace = PersistentWorkspace
+	w = runWorkspace(&settings, run)
+	if w.Dir != filepath.Join(root, "jobs", "my_job_1-99de59b6") {
+		t.Errorf("Unexpected persistent workspace %s", w.Dir)
+	}
+	other := &Run{UUID: "other", Job: Job{Name: "my_job_1", Workspace: PersistentWorkspace}}
+	if dir := runWorkspace(&settings, other).Dir; dir == w.Dir {
+		t.Errorf("Jobs '%s' and '%s' share the persistent workspace %s", run.Job.Name, other.Job.Name, dir)
+	}
+	if w.Home != filepath.Join(root, "runs", "uuid", "home") {
+		t.Errorf("Unexpected home %s", w.Home)
+	}
+}
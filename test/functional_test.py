@@ -171,11 +171,11 @@ class TestGoAPI(unittest.TestCase):
         self.api.add_task_to_job(self.test_task, self.test_job)
 
         job = self.api.get_job(self.test_job)
-        self.assertIn(self.test_task, job['tasks'])
+        self.assertIn(self.test_task, [task['name'] for task in job['tasks']])
 
         self.api.remove_task_from_job(0, self.test_job)
         job = self.api.get_job(self.test_job)
-        self.assertNotIn(self.test_task, job['tasks'])
+        self.assertNotIn(self.test_task, [task['name'] for task in job['tasks']])
 
     def test_add_remove_trigger_to_job(self):
         self.api.add_job(self.test_job)
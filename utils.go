@@ -2,9 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func marshal(item interface{}, w http.ResponseWriter) {
@@ -36,3 +39,61 @@ func unmarshal(r io.Reader, k string, w http.ResponseWriter) (payload map[string
 
 	return
 }
+
+// Decodes a JSON body into v, for payloads that are not a flat string map.
+func decode(r io.Reader, v interface{}) error {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Converts JSON scalars to strings, so that booleans can be given as such.
+func stringValues(values map[string]interface{}) (map[string]string, error) {
+	strings := make(map[string]string)
+	for name, value := range values {
+		switch v := value.(type) {
+		case string:
+			strings[name] = v
+		case bool:
+			strings[name] = strconv.FormatBool(v)
+		case float64:
+			strings[name] = strconv.FormatFloat(v, 'f', -1, 64)
+		default:
+			return nil, fmt.Errorf("Invalid value for '%s'", name)
+		}
+	}
+	return strings, nil
+}
+
+// Returns who sent a request, from its basic authentication or from the
+// X-Author header, empty when unknown.
+func author(r *http.Request) string {
+	if user, _, ok := r.BasicAuth(); ok {
+		return user
+	}
+	return r.Header.Get("X-Author")
+}
+
+// Parses a time given as an RFC 3339 time or as a date.
+func parseTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		t, err = time.Parse("2006-01-02", value)
+	}
+	return t, err
+}
+
+// Returns the count query parameter, def when it is not given.
+func countValue(r *http.Request, def int) (int, error) {
+	value := r.FormValue("count")
+	if value == "" {
+		return def, nil
+	}
+	count, err := strconv.Atoi(value)
+	if err != nil || count <= 0 {
+		return 0, fmt.Errorf("Invalid 'count', expected a positive number")
+	}
+	return count, nil
+}
@@ -72,14 +72,42 @@ app.controller('MainCtl', function ($scope, $timeout, Run) {
 		});
 	};
 
+	// Run whose logs are followed, sent again when the connection opens
+	var subscription = null;
+	var send = function(command) {
+		if (conn.readyState == WebSocket.OPEN) {
+			conn.send(JSON.stringify(command));
+		}
+	};
+
 	conn.onopen = function(e) {
 		console.log("Connected");
+		if (subscription) {
+			send(subscription);
+		}
 	};
 
 	conn.onmessage = function(e){
+		var message = JSON.parse(e.data);
 		$scope.$apply(function(){
-			$scope.recent = JSON.parse(e.data);
+			switch (message.type) {
+			case "runs":
+				$scope.recent = message.runs;
+				break;
+			case "log":
+				$scope.$broadcast('log', message);
+				break;
+			}
 		});
 	}
 
+	$scope.$on('subscribe', function(e, run, offsets) {
+		subscription = {command: "subscribe", run: run, offsets: offsets};
+		send(subscription);
+	});
+	$scope.$on('unsubscribe', function(e, run) {
+		subscription = null;
+		send({command: "unsubscribe", run: run});
+	});
+
 });
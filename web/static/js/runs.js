@@ -30,16 +30,41 @@ function RunsCtl($scope, Run) {
 	};
 }
 
-function RunCtl($scope, $routeParams, $timeout, Run) {
+function RunCtl($scope, $routeParams, $timeout, $location, Run) {
 	var update = function() {
 		Run.get({id: $routeParams.run}, function(data) {
 			$scope.run = data;
-			if (data.status == "Running") {
+			if (data.status == "Running" || data.status == "Queued") {
 				$timeout(update, 3000);
 			}
 		});
 	};
+	$scope.cancelRun = function() {
+		Run.cancel({id: $routeParams.run}, update);
+	};
+	$scope.rerun = function(fromFailed) {
+		Run.rerun({id: $routeParams.run}, {from_failed: fromFailed}, function(data) {
+			$location.path('/runs/' + data.uuid);
+		});
+	};
 	$scope.run |= {};
 	update();
+
+	// Lines of each log, streamed while the tasks are running
+	$scope.logs = {};
+	$scope.$on('log', function(e, message) {
+		if (message.run != $routeParams.run) {
+			return;
+		}
+		var lines = $scope.logs[message.log] || [];
+		if (message.offset <= lines.length) {
+			lines = lines.slice(0, message.offset).concat(message.lines);
+		}
+		$scope.logs[message.log] = lines;
+	});
+	$scope.$emit('subscribe', $routeParams.run, {});
+	$scope.$on('$destroy', function() {
+		$scope.$emit('unsubscribe', $routeParams.run);
+	});
 	
 }
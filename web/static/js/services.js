@@ -13,7 +13,10 @@ gorunnerServices.factory('Job', ['$resource', function($resource){
 gorunnerServices.factory('Task', ['$resource', function($resource){
 	return $resource('/tasks/:id', {}, {
 		update: { method: "PUT" , params: {id: '@id'}},
-		jobs: { method: "GET", url: 'tasks/:id/jobs', params: {id: '@id'}, isArray: true}
+		jobs: { method: "GET", url: 'tasks/:id/jobs', params: {id: '@id'}, isArray: true},
+		revisions: { method: "GET", url: '/tasks/:id/revisions', params: {id: '@id'}, isArray: true},
+		diff: { method: "GET", url: '/tasks/:id/diff', params: {id: '@id'}},
+		restore: { method: "POST", url: '/tasks/:id/revisions/:revision/restore', params: {id: '@id', revision: '@revision'}}
 	})
 }]);
 
@@ -25,5 +28,8 @@ gorunnerServices.factory('Trigger', ['$resource', function($resource){
 }]);
 
 gorunnerServices.factory('Run', ['$resource', function($resource) {
-	return $resource('/runs/:id', {}, {})
+	return $resource('/runs/:id', {}, {
+		cancel: { method: "POST", url: '/runs/:id/cancel', params: {id: '@id'}},
+		rerun: { method: "POST", url: '/runs/:id/rerun', params: {id: '@id'}}
+	})
 }]);
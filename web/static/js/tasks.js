@@ -16,6 +16,19 @@ function TasksCtl($scope, Task) {
 function TaskCtl($scope, $routeParams, Task) {
 	$scope.task = Task.get({id: $routeParams.task});
 	$scope.jobs = Task.jobs({id: $routeParams.task});
+	$scope.revisions = Task.revisions({id: $routeParams.task});
+
+	$scope.showDiff = function(revision) {
+		$scope.diff = Task.diff({id: $routeParams.task, from: revision.number});
+	};
+
+	$scope.restore = function(revision) {
+		Task.restore({id: $routeParams.task, revision: revision.number}, {}, function(task) {
+			$scope.task = task;
+			$scope.revisions = Task.revisions({id: $routeParams.task});
+			$scope.diff = null;
+		});
+	};
 
 	$scope.saveTask = function() {
 		Task.update({id: $routeParams.task, script: $scope.task.script});